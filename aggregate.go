@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Count yields a single item: the number of input items.
+func Count() Filter {
+	return FilterFunc(func(arg Arg) error {
+		n := 0
+		for range arg.In {
+			n++
+		}
+		arg.Out <- strconv.Itoa(n)
+		return nil
+	})
+}
+
+// AggregateFilter is a Filter that summarizes numeric input items in
+// a single output item.
+type AggregateFilter struct {
+	name    string // Sum, Mean, Min, or Max
+	col     int
+	lenient bool
+}
+
+// Sum yields a single item: the sum of the input items, which must be
+// numbers. The numbers can be taken from a column of every item by
+// calling Column. E.g., the following prints the total size of the
+// files listed by "ls -l":
+//
+//	stream.Run(
+//		stream.Command("ls", "-l"),
+//		stream.Sum().Column(5).IgnoreInvalid(),
+//		stream.WriteLines(os.Stdout),
+//	)
+func Sum() *AggregateFilter {
+	return &AggregateFilter{name: "Sum"}
+}
+
+// Mean yields a single item: the arithmetic mean of the input items,
+// which must be numbers. Nothing is yielded if there is no input.
+func Mean() *AggregateFilter {
+	return &AggregateFilter{name: "Mean"}
+}
+
+// Min yields a single item: the smallest of the input items, which
+// must be numbers. Nothing is yielded if there is no input.
+func Min() *AggregateFilter {
+	return &AggregateFilter{name: "Min"}
+}
+
+// Max yields a single item: the largest of the input items, which
+// must be numbers. Nothing is yielded if there is no input.
+func Max() *AggregateFilter {
+	return &AggregateFilter{name: "Max"}
+}
+
+// Column adjusts a so that the numbers are taken from column n of
+// every item (see Columns). Column 0 means the entire item.
+func (a *AggregateFilter) Column(n int) *AggregateFilter {
+	a.col = n
+	return a
+}
+
+// IgnoreInvalid adjusts a so that items that are not numbers, or that
+// lack the selected column, are skipped instead of making the filter
+// fail.
+func (a *AggregateFilter) IgnoreInvalid() *AggregateFilter {
+	a.lenient = true
+	return a
+}
+
+// RunFilter summarizes the input. It implements the Filter interface.
+func (a *AggregateFilter) RunFilter(arg Arg) error {
+	n := 0
+	var sum, lo, hi float64
+	for s := range arg.In {
+		_, c := column(s, a.col)
+		v, err := strconv.ParseFloat(c, 64)
+		if err != nil {
+			if a.lenient {
+				continue
+			}
+			return fmt.Errorf("stream.%s: %q is not a number", a.name, c)
+		}
+		if n == 0 || v < lo {
+			lo = v
+		}
+		if n == 0 || v > hi {
+			hi = v
+		}
+		sum += v
+		n++
+	}
+	var result float64
+	switch {
+	case a.name == "Sum":
+		result = sum
+	case n == 0:
+		return nil
+	case a.name == "Mean":
+		result = sum / float64(n)
+	case a.name == "Min":
+		result = lo
+	case a.name == "Max":
+		result = hi
+	}
+	arg.Out <- strconv.FormatFloat(result, 'f', -1, 64)
+	return nil
+}
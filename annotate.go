@@ -0,0 +1,60 @@
+package stream
+
+import "time"
+
+// Timestamp returns a filter that prefixes every item with the time
+// at which the filter received it, formatted using layout (see
+// time.Time.Format), followed by a space. E.g.,
+//
+//	stream.Run(
+//		stream.Command("tail", "-f", "/var/log/syslog"),
+//		stream.Timestamp(time.RFC3339),
+//		stream.WriteLines(os.Stdout),
+//	)
+//
+// The time is obtained from Arg.Clock.
+func Timestamp(layout string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		clock := arg.Clock()
+		for s := range arg.In {
+			arg.Out <- clock.Now().Format(layout) + " " + s
+		}
+		return nil
+	})
+}
+
+// ElapsedFilter is a Filter that prefixes items with elapsed times.
+type ElapsedFilter struct {
+	sincePrevious bool
+}
+
+// Elapsed returns a filter that prefixes every item with the time
+// elapsed since the filter started (which is when the pipeline
+// started, for all practical purposes), followed by a space. Times
+// are formatted like time.Duration.String, rounded to milliseconds.
+func Elapsed() *ElapsedFilter {
+	return &ElapsedFilter{}
+}
+
+// SincePrevious adjusts e so that items are prefixed with the time
+// elapsed since the previous item was received (or since the filter
+// started, for the first item).
+func (e *ElapsedFilter) SincePrevious() *ElapsedFilter {
+	e.sincePrevious = true
+	return e
+}
+
+// RunFilter annotates items with elapsed times. It implements the
+// Filter interface.
+func (e *ElapsedFilter) RunFilter(arg Arg) error {
+	clock := arg.Clock()
+	start := clock.Now()
+	for s := range arg.In {
+		now := clock.Now()
+		arg.Out <- now.Sub(start).Round(time.Millisecond).String() + " " + s
+		if e.sincePrevious {
+			start = now
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package stream
+
+import "iter"
+
+// WithBatchSize arranges for items to be passed between the top-level
+// stages of a pipeline in batches of up to n items instead of one at
+// a time, which reduces the per-item cost of channel operations for
+// pipelines of simple filters. Filters still see their items one at a
+// time, but some built-in filters (Items, Repeat, Map, If, Grep, and
+// GrepNot) process whole batches directly. Batching is not used by
+// pipelines that are instrumented by WithWatchdog or WithCollector.
+func WithBatchSize(n int) RunOption {
+	return func(r *Runner) { r.env.batchSize = n }
+}
+
+// batchArg is the argument of a stage of a batched pipeline.
+type batchArg = ArgOf[[]string, []string]
+
+// builtinFilter is a filter that, besides processing items one at a
+// time, can optionally process batches of items (see WithBatchSize)
+// or run lazily (see WithLazyExecution). Ownership of a batch passes
+// to the filter that receives it, which may modify it and send it on.
+type builtinFilter struct {
+	name    string // Used in error messages (see stageName)
+	items   func(Arg) error
+	batches func(batchArg) error                       // May be nil
+	lazy    func(in iter.Seq[string]) iter.Seq[string] // May be nil
+}
+
+func (b *builtinFilter) RunFilter(arg Arg) error { return b.items(arg) }
+
+// forEachBatched is like forEachWhile, but passes batches of items
+// between filters.
+func forEachBatched(env *runEnv, filters []Filter, fn func(s string) bool) error {
+	stages := make([]FilterOf[[]string], len(filters))
+	for i, f := range filters {
+		stages[i] = batched(f, env.batchSize)
+	}
+	return forEachWhile(env, SequenceOf(stages...), func(b []string) bool {
+		for _, s := range b {
+			if !fn(s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// batched returns a stage of a batched pipeline that runs f.
+func batched(f Filter, size int) FilterOf[[]string] {
+	if t, ok := f.(*topStage); ok {
+		inner := t.f
+		if n, ok := inner.(*namedFilter); ok {
+			inner = FilterFunc(n.run) // The name is part of the StageError
+		}
+		stage := batched(inner, size)
+		return StageFunc[[]string, []string](func(arg batchArg) error {
+			return t.run(arg.Logger(), arg.Context(), func() error {
+				return stage.RunFilter(arg)
+			})
+		})
+	}
+	if b, ok := f.(*builtinFilter); ok && b.batches != nil {
+		return StageFunc[[]string, []string](b.batches)
+	}
+	return StageFunc[[]string, []string](func(arg batchArg) error {
+		in := make(chan string, size)
+		go func() {
+			defer close(in)
+			for b := range arg.In {
+				for _, s := range b {
+					in <- s
+				}
+			}
+		}()
+		out := make(chan string, size)
+		done := make(chan struct{})
+		go func() {
+			rebatch(out, arg.Out, size)
+			close(done)
+		}()
+		err := f.RunFilter(Arg{In: in, Out: out, env: arg.env, inStop: arg.inStop, outStop: arg.outStop})
+		close(out)
+		<-done
+		for range in { // Discard unhandled input
+		}
+		return err
+	})
+}
+
+// rebatch sends the items received from in to out in batches of up
+// to size items. A partial batch is sent whenever no more items are
+// immediately available, so that batching does not delay items.
+func rebatch(in <-chan string, out chan<- []string, size int) {
+	batch := make([]string, 0, size)
+	for s := range in {
+		batch = append(batch, s)
+		if len(batch) == size || len(in) == 0 {
+			out <- batch
+			batch = make([]string, 0, size)
+		}
+	}
+	if len(batch) > 0 {
+		out <- batch
+	}
+}
+
+// sendBatches emits n items produced by item in batches.
+func sendBatches(arg batchArg, n int, item func(i int) string) error {
+	size := max(arg.env.batchSize, 1)
+	for i := 0; i < n; i += size {
+		batch := make([]string, min(size, n-i))
+		for j := range batch {
+			batch[j] = item(i + j)
+		}
+		if err := arg.Send(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -22,6 +23,19 @@ func BenchmarkFive(b *testing.B) {
 	stream.Run(stream.Repeat("", b.N), f, f, f, f)
 }
 
+func BenchmarkFiveBatched(b *testing.B) {
+	f := stream.Map(func(s string) string { return s })
+	r := stream.NewRunner(stream.WithBatchSize(100))
+	r.Run(stream.Repeat("", b.N), f, f, f, f)
+}
+
+func BenchmarkFirstLazy(b *testing.B) {
+	r := stream.NewRunner(stream.WithLazyExecution())
+	for i := 0; i < b.N; i++ {
+		r.Run(stream.Repeat("", 1<<20), stream.Map(strings.ToUpper), stream.First(1))
+	}
+}
+
 func BenchmarkWrite(b *testing.B) {
 	f, err := os.Create("/dev/null")
 	if err != nil {
@@ -55,6 +69,24 @@ func BenchmarkSort3(b *testing.B) {
 	)
 }
 
+func BenchmarkSortWide(b *testing.B) {
+	var lines []string
+	for i := 0; i < 10000; i++ {
+		lines = append(lines, fmt.Sprintf("-rw-r--r-- 1 user group %d Jan %d 12:00 file%d.txt", i*7919%10007, i%28+1, i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stream.Run(stream.ItemsFromSlice(lines), stream.Sort().Num(5).Num(7).Text(9))
+	}
+}
+
+func BenchmarkSortParallel(b *testing.B) {
+	stream.Run(
+		stream.Numbers(1, b.N),
+		stream.Sort().Parallel(4),
+	)
+}
+
 func BenchmarkCmd(b *testing.B) {
 	stream.Run(
 		stream.Repeat("hello", b.N),
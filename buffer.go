@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// BufferFilter is a Filter that records its input so that it can be
+// replayed any number of times.
+type BufferFilter struct {
+	limit int64 // Bytes kept in memory before spilling to disk
+
+	mu        sync.Mutex
+	recording bool
+	ready     chan struct{} // Closed when the current recording is complete
+	items     []string      // Items held in memory
+	spill     *os.File      // Items that did not fit in memory, if any
+	spilled   int           // Number of items in spill
+	err       error         // Error encountered while recording
+}
+
+// Buffer returns a filter that copies its input to its output while
+// recording it. The recorded items can then be emitted again by the
+// filters returned by Replay, e.g., to make two passes over the same
+// data:
+//
+//	b := stream.Buffer()
+//	stream.Run(stream.Find(dir), b, stream.Sort().Num(1), ...)
+//	stream.Run(b.Replay(), ...)
+//	stream.Run(b.Replay(), ...)
+//	b.Close()
+//
+// Up to 64MiB of items are kept in memory (less if the memory budget
+// of the pipeline is exhausted; see MemoryBudget); the remainder is
+// written to a temporary file that is removed by Close. Each
+// execution of the filter replaces the previous recording, and must
+// not overlap with replays of the previous recording.
+func Buffer() *BufferFilter {
+	ready := make(chan struct{})
+	close(ready)
+	return &BufferFilter{limit: 64 << 20, ready: ready}
+}
+
+// MemoryLimit adjusts b so that at most n bytes of items are kept in
+// memory before the rest are written to a temporary file.
+func (b *BufferFilter) MemoryLimit(n int64) *BufferFilter {
+	b.limit = n
+	return b
+}
+
+// RunFilter records and copies its input. It implements the Filter
+// interface.
+func (b *BufferFilter) RunFilter(arg Arg) error {
+	ready := make(chan struct{})
+	b.mu.Lock()
+	b.waitLocked()
+	b.reset()
+	b.recording, b.ready = true, ready
+	b.mu.Unlock()
+
+	var items []string
+	var size int64
+	var spill *os.File
+	var w *bufio.Writer
+	spilled := 0
+	err := func() error {
+		for s := range arg.In {
+			n := itemSize(s)
+			if spill == nil && size+n <= b.limit && arg.Reserve(n) == nil {
+				items = append(items, s)
+				size += n
+			} else {
+				if spill == nil {
+					var err error
+					if spill, err = os.CreateTemp("", "stream-buffer"); err != nil {
+						return err
+					}
+					w = bufio.NewWriter(spill)
+				}
+				if _, err := w.WriteString(s + "\x00"); err != nil {
+					return err
+				}
+				spilled++
+			}
+			arg.Out <- s
+		}
+		if w != nil {
+			return w.Flush()
+		}
+		return nil
+	}()
+	arg.Release(size) // Recorded items outlive the pipeline
+
+	b.mu.Lock()
+	b.items, b.spill, b.spilled, b.err = items, spill, spilled, err
+	b.recording = false
+	b.mu.Unlock()
+	close(ready)
+	return err
+}
+
+// Replay returns a filter that emits the items recorded by b. If b is
+// still recording, the returned filter first waits for the recording
+// to finish. If recording failed, the returned filter fails with the
+// same error.
+func (b *BufferFilter) Replay() Filter {
+	return FilterFunc(func(arg Arg) error {
+		b.mu.Lock()
+		ready := b.ready
+		b.mu.Unlock()
+		<-ready
+
+		b.mu.Lock()
+		items, spill, spilled, err := b.items, b.spill, b.spilled, b.err
+		b.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, s := range items {
+			arg.Out <- s
+		}
+		if spill == nil {
+			return nil
+		}
+		// Use a separate reader so that concurrent replays work.
+		rd := bufio.NewReader(io.NewSectionReader(spill, 0, 1<<62))
+		for i := 0; i < spilled; i++ {
+			s, err := rd.ReadString(0)
+			if err != nil {
+				return err
+			}
+			arg.Out <- s[:len(s)-1]
+		}
+		return nil
+	})
+}
+
+// Close discards the items recorded by b and removes its temporary
+// file, if any.
+func (b *BufferFilter) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.waitLocked()
+	return b.reset()
+}
+
+// waitLocked waits until b is not recording. b.mu must be held; it is
+// released while waiting.
+func (b *BufferFilter) waitLocked() {
+	for b.recording {
+		ready := b.ready
+		b.mu.Unlock()
+		<-ready
+		b.mu.Lock()
+	}
+}
+
+// reset discards the recording. b.mu must be held.
+func (b *BufferFilter) reset() error {
+	var err error
+	if b.spill != nil {
+		err = b.spill.Close()
+		if rerr := os.Remove(b.spill.Name()); err == nil {
+			err = rerr
+		}
+	}
+	b.items, b.spill, b.spilled, b.err = nil, nil, 0, nil
+	return err
+}
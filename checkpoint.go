@@ -0,0 +1,151 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// CheckpointFilter is a Filter that records the output of a sequence
+// of filters in a file so that a later execution can reuse it.
+type CheckpointFilter struct {
+	path    string
+	filters []Filter
+	key     func(string) string
+}
+
+// Checkpoint returns a filter that behaves like Sequence(filters...)
+// but also records every output item in the file named by path. If
+// path already exists when the filter runs, the recorded items are
+// emitted and filters are not executed at all. E.g., the expensive
+// hashing below is only done once, even if the pipeline is run many
+// times:
+//
+//	stream.Run(
+//		stream.Find(dir).IfMode(os.FileMode.IsRegular),
+//		stream.Checkpoint("/tmp/hashes", stream.Parallel(8, hasher)),
+//		...
+//	)
+//
+// While the filters run, items are recorded in path+".partial",
+// which is renamed to path once the filters finish successfully.
+// Remove path to force the filters to run again. Items are recorded
+// NUL-terminated, so they may contain newlines.
+//
+// By default an existing partial file is discarded; see ResumeBy.
+func Checkpoint(path string, filters ...Filter) *CheckpointFilter {
+	return &CheckpointFilter{path: path, filters: filters}
+}
+
+// ResumeBy adjusts c so that if an earlier execution was interrupted,
+// the items recorded so far are emitted, and the execution resumes
+// where it left off. The input item that produced a recorded output
+// item s is assumed to be key(s); such input items are not passed to
+// the filters again. E.g., if the filters turn every path into
+// "hash path", use
+//
+//	stream.Checkpoint(file, hasher).ResumeBy(func(s string) string {
+//		_, path, _ := strings.Cut(s, " ")
+//		return path
+//	})
+func (c *CheckpointFilter) ResumeBy(key func(string) string) *CheckpointFilter {
+	c.key = key
+	return c
+}
+
+// RunFilter emits the recorded items, or runs the filters while
+// recording their output. It implements the Filter interface.
+func (c *CheckpointFilter) RunFilter(arg Arg) error {
+	if f, err := os.Open(c.path); err == nil {
+		defer f.Close()
+		_, err := replayCheckpoint(f, func(s string) { arg.Out <- s })
+		return err
+	}
+
+	partial := c.path + ".partial"
+	done := map[string]bool{}
+	var f *os.File
+	var err error
+	if c.key == nil {
+		f, err = os.Create(partial)
+	} else {
+		f, err = os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0666)
+		if err == nil {
+			var n int64
+			n, err = replayCheckpoint(f, func(s string) {
+				done[c.key(s)] = true
+				arg.Out <- s
+			})
+			if err == nil {
+				err = f.Truncate(n) // Drop an incomplete last item
+			}
+			if err == nil {
+				_, err = f.Seek(n, io.SeekStart)
+			}
+			if err != nil {
+				f.Close()
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	in := make(chan string, channelBuffer)
+	out := make(chan string, channelBuffer)
+	go func() {
+		for s := range arg.In {
+			if !done[s] {
+				in <- s
+			}
+		}
+		close(in)
+	}()
+	e := &filterErrors{}
+	go runFilter(Sequence(c.filters...), Arg{In: in, Out: out, env: arg.env}, e)
+	var werr error
+	for s := range out {
+		if werr == nil {
+			_, werr = w.WriteString(s + "\x00")
+			if werr == nil && len(out) == 0 {
+				werr = w.Flush() // Keep the file current while waiting
+			}
+		}
+		arg.Out <- s
+	}
+	if werr == nil {
+		werr = w.Flush()
+	}
+	if werr == nil {
+		werr = f.Sync()
+	}
+	if err := f.Close(); werr == nil {
+		werr = err
+	}
+	if err := e.getError(); err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	return os.Rename(partial, c.path)
+}
+
+// replayCheckpoint calls fn for every complete item recorded in r and
+// returns the number of bytes occupied by those items.
+func replayCheckpoint(r io.Reader, fn func(string)) (int64, error) {
+	rd := bufio.NewReader(r)
+	var n int64
+	for {
+		s, err := rd.ReadString(0)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(s))
+		fn(s[:len(s)-1])
+	}
+}
@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and tickers to filters (see
+// Arg.Clock). Tests can supply a fake Clock via WithClock to make
+// time-dependent filters like Progress and Debug deterministic.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on the channel returned by C, like
+// time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// systemClock is a Clock that uses the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// WithClock makes c available to filters via Arg.Clock.
+func WithClock(c Clock) RunOption {
+	return func(r *Runner) { r.env.clock = c }
+}
+
+// WithRand makes filters that need random numbers (e.g., Sample)
+// draw them from src instead of a generator seeded with the current
+// time. Since filters run concurrently, the output is only
+// reproducible if a single filter in the pipeline uses random numbers.
+func WithRand(src rand.Source) RunOption {
+	return func(r *Runner) { r.env.rand = &lockedSource{src: src} }
+}
+
+// lockedSource is a rand.Source that is safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// Clock returns the clock filters should use to read the time. By
+// default, it uses the time package.
+func (a ArgOf[T, U]) Clock() Clock {
+	if a.env == nil || a.env.clock == nil {
+		return systemClock{}
+	}
+	return a.env.clock
+}
+
+// Rand returns a random number generator for the filter. By default,
+// it is seeded with the current time.
+func (a ArgOf[T, U]) Rand() *rand.Rand {
+	if a.env == nil || a.env.rand == nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(a.env.rand)
+}
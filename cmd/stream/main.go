@@ -0,0 +1,85 @@
+// Command stream runs a pipeline of filters from the
+// github.com/ghemawat/stream package over its standard input. The
+// pipeline is described using the syntax accepted by stream.Parse.
+// E.g.,
+//
+//	git ls-files | stream 'grep \.go$ | xargs wc -l | sort -nr 1 | first 5'
+//
+// The whole pipeline must be a single argument, so that the quoting
+// within it is interpreted by stream.Parse rather than by the shell.
+// Lines read from standard input form the input of the first filter,
+// and the output of the last filter is written to standard output.
+//
+// Usage:
+//
+//	stream [-0] [-in=false] pipeline
+//	stream -list
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ghemawat/stream"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command with command-line arguments args (not
+// including the program name) and returns its exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("stream", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	nul := flags.Bool("0", false, "read and write NUL-terminated items instead of lines")
+	input := flags.Bool("in", true, "read items from standard input")
+	list := flags.Bool("list", false, "list the available filters and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: stream [flags] 'pipeline'")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *list {
+		fmt.Fprintln(stdout, strings.Join(stream.RegisteredFilters(), "\n"))
+		return 0
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	f, err := stream.Parse(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var filters []stream.Filter
+	if *input {
+		if *nul {
+			filters = append(filters, stream.ReadNulTerminated(stdin))
+		} else {
+			filters = append(filters, stream.ReadLines(stdin))
+		}
+	}
+	filters = append(filters, f)
+	if *nul {
+		filters = append(filters, stream.WriteNulTerminated(stdout))
+	} else {
+		filters = append(filters, stream.WriteLines(stdout))
+	}
+	if err := stream.RunContext(ctx, filters...); err != nil {
+		fmt.Fprintln(stderr, "stream:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		stdin  string
+		stdout string
+		stderr string // Substring expected in standard error
+		code   int
+	}{
+		// The pipeline is a single argument whose quoting is
+		// interpreted by stream.Parse.
+		{[]string{"grep 'a b' | sort"}, "x a b\na b c\nab\n", "a b c\nx a b\n", "", 0},
+		{[]string{`grep "^a|c$" | sort -t 1`}, "abc\nbc\ncb\n", "abc\nbc\n", "", 0},
+		{[]string{"-0", "sort"}, "b\x00a\nx\x00", "a\nx\x00b\x00", "", 0},
+		{[]string{"-0", "grep -v b"}, "b\x00c", "c\x00", "", 0},
+		{[]string{"-in=false", "numbers 1 3"}, "ignored\n", "1\n2\n3\n", "", 0},
+		{[]string{"-in", "first 1"}, "a\nb\n", "a\n", "", 0},
+		{[]string{"-list"}, "", "", "", 0},
+
+		// Usage errors.
+		{nil, "", "", "usage: stream", 2},
+		{[]string{"grep", "a"}, "", "", "usage: stream", 2},
+		{[]string{"-x", "sort"}, "", "", "flag provided but not defined: -x", 2},
+		{[]string{"nosuch"}, "", "", `unknown filter "nosuch"`, 2},
+		{[]string{"grep 'a"}, "", "", "stream.Parse", 2},
+
+		// Failures while running the pipeline.
+		{[]string{"cat /no/such/file"}, "", "", "stream: ", 1},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+		if code != test.code {
+			t.Errorf("%q: exit status %d; expected %d (stderr %q)", test.args, code, test.code, stderr.String())
+		}
+		if test.args != nil && test.args[0] == "-list" {
+			if !strings.Contains(stdout.String(), "grep\n") {
+				t.Errorf("-list: output %q does not include grep", stdout.String())
+			}
+		} else if got := stdout.String(); got != test.stdout {
+			t.Errorf("%q: output %q; expected %q", test.args, got, test.stdout)
+		}
+		if !strings.Contains(stderr.String(), test.stderr) {
+			t.Errorf("%q: standard error %q does not contain %q", test.args, stderr.String(), test.stderr)
+		}
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, []string{"-in=false", "sh 'sleep 10'"}, strings.NewReader(""), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "context canceled") {
+		t.Errorf("exit status %d, stderr %q; expected failure due to cancellation", code, stderr.String())
+	}
+}
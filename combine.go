@@ -0,0 +1,458 @@
+package stream
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// Tee copies its input to its output, and in addition passes a copy
+// of every input item to each of branches, which run concurrently with
+// the rest of the pipeline. The output of the branches is discarded.
+// E.g., the following logs all files found and continues with the Go
+// files:
+//
+//	stream.Run(
+//		stream.Find("."),
+//		stream.Tee(stream.WriteLines(logFile)),
+//		stream.Grep(`\.go$`),
+//		...
+//	)
+//
+// A branch that stops reading its input (e.g., First) no longer gets
+// copies, and the errors of the branches are returned by Tee.
+func Tee(branches ...Filter) Filter {
+	return FilterFunc(func(arg Arg) error {
+		e := &filterErrors{}
+		var wg sync.WaitGroup
+		ins, stops := make([]chan string, len(branches)), make([]*stopSignal, len(branches))
+		for i, f := range branches {
+			out := make(chan string, channelBuffer)
+			ins[i], stops[i] = startBranch(f, arg, out, nil, e)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range out { // Discard output of branch
+				}
+			}()
+		}
+		fanOut(arg.In, ins, stops, func(s string) { arg.Out <- s })
+		wg.Wait()
+		return e.getError()
+	})
+}
+
+// startBranch starts f with a new input channel, which it returns
+// along with the signal raised when f wants no more input. The output
+// of f is sent to out, and out is closed when f finishes.
+func startBranch(f Filter, arg Arg, out chan string, outStop *stopSignal, e *filterErrors) (chan string, *stopSignal) {
+	in := make(chan string, channelBuffer)
+	inStop := newStopSignal()
+	go runFilter(f, Arg{In: in, Out: out, env: arg.env, inStop: inStop, outStop: outStop}, e)
+	return in, inStop
+}
+
+// fanOut sends every item received from in to each channel in ins
+// (unless the corresponding stop signal has been raised), and also
+// passes it to fn if fn is not nil. It closes the channels in ins
+// when in is exhausted. If fn is nil, fanOut returns early once all
+// stop signals have been raised.
+func fanOut(in <-chan string, ins []chan string, stops []*stopSignal, fn func(string)) {
+	live := len(ins)
+	for s := range in {
+		for i, c := range ins {
+			if c == nil {
+				continue
+			}
+			select {
+			case c <- s:
+			case <-stops[i].done():
+				close(c)
+				ins[i] = nil
+				live--
+			}
+		}
+		if fn != nil {
+			fn(s)
+		} else if live == 0 {
+			return
+		}
+	}
+	for _, c := range ins {
+		if c != nil {
+			close(c)
+		}
+	}
+}
+
+// MergeFilter is a Filter that runs several filters concurrently and
+// combines their output.
+type MergeFilter struct {
+	filters []Filter
+	ordered bool
+}
+
+// Merge runs filters concurrently. Each of them gets a copy of the
+// input of Merge (which is empty if Merge is the first filter in a
+// pipeline), and their outputs are interleaved in the order in which
+// they are produced. The order can be adjusted by calling MergeFilter
+// methods.
+func Merge(filters ...Filter) *MergeFilter {
+	return &MergeFilter{filters: filters}
+}
+
+// InOrder adjusts m so that its output is the output of its first
+// filter, followed by the output of its second filter, and so on. The
+// filters still run concurrently, so the output of all but the first
+// filter is held in memory (see MemoryBudget) until it is emitted.
+func (m *MergeFilter) InOrder() *MergeFilter {
+	m.ordered = true
+	return m
+}
+
+// RunFilter runs the filters. It implements the Filter interface.
+func (m *MergeFilter) RunFilter(arg Arg) error {
+	e := &filterErrors{}
+	n := len(m.filters)
+	ins, stops, outs := make([]chan string, n), make([]*stopSignal, n), make([]chan string, n)
+	// If InOrder, a held branch is told to stop when its output no
+	// longer fits in the memory budget, or when the output of m is no
+	// longer wanted.
+	outStops := make([]*stopSignal, n)
+	for i, f := range m.filters {
+		outStops[i] = arg.outStop
+		if m.ordered && i > 0 {
+			outStops[i] = newStopSignal()
+		}
+		outs[i] = make(chan string, channelBuffer)
+		ins[i], stops[i] = startBranch(f, arg, outs[i], outStops[i], e)
+	}
+	if m.ordered && n > 1 {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-arg.outStop.done():
+				for _, st := range outStops[1:] {
+					st.raise()
+				}
+			case <-finished:
+			}
+		}()
+	}
+	fanned := make(chan struct{})
+	go func() {
+		fanOut(arg.In, ins, stops, nil)
+		close(fanned)
+	}()
+	defer func() { <-fanned }()
+
+	var wg sync.WaitGroup
+	held := make([][]string, n)
+	var reserved int64
+	var mu sync.Mutex // Protects reserved
+	defer func() { arg.Release(reserved) }()
+	for i, out := range outs {
+		if m.ordered && i == 0 {
+			continue // Emitted below
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range out {
+				if !m.ordered {
+					arg.Out <- s
+					continue
+				}
+				if err := arg.Reserve(itemSize(s)); err != nil {
+					e.record(err)
+					outStops[i].raise()
+					break
+				}
+				mu.Lock()
+				reserved += itemSize(s)
+				mu.Unlock()
+				held[i] = append(held[i], s)
+			}
+			for range out { // Discard the rest
+			}
+		}()
+	}
+	if m.ordered && n > 0 {
+		for s := range outs[0] {
+			arg.Out <- s
+		}
+	}
+	wg.Wait()
+	for _, items := range held {
+		for _, s := range items {
+			arg.Out <- s
+		}
+	}
+	return e.getError()
+}
+
+// ZipFilter is a Filter that pairs up the outputs of two filters.
+type ZipFilter struct {
+	a, b     Filter
+	join     func(a, b string) string
+	shortest bool
+}
+
+// Zip runs filters a and b concurrently and emits the i-th output
+// item of a joined with the i-th output item of b, separated by a tab,
+// like "paste". Each of a and b gets a copy of the input of Zip (which
+// is empty if Zip is the first filter in a pipeline). If one filter
+// produces fewer items than the other, the missing items are empty.
+// The pairing can be adjusted by calling ZipFilter methods.
+func Zip(a, b Filter) *ZipFilter {
+	return &ZipFilter{a: a, b: b, join: func(a, b string) string { return a + "\t" + b }}
+}
+
+// Separator adjusts z so that sep separates the paired items instead
+// of a tab.
+func (z *ZipFilter) Separator(sep string) *ZipFilter {
+	z.join = func(a, b string) string { return a + sep + b }
+	return z
+}
+
+// JoinFunc adjusts z so that it emits fn(a, b) for every pair of items
+// a and b.
+func (z *ZipFilter) JoinFunc(fn func(a, b string) string) *ZipFilter {
+	z.join = fn
+	return z
+}
+
+// Shortest adjusts z so that it stops once either filter has no more
+// output, instead of pairing the rest of the other filter's output
+// with empty items.
+func (z *ZipFilter) Shortest() *ZipFilter {
+	z.shortest = true
+	return z
+}
+
+// RunFilter pairs up the outputs. It implements the Filter interface.
+func (z *ZipFilter) RunFilter(arg Arg) error {
+	e := &filterErrors{}
+	aout, bout := make(chan string, channelBuffer), make(chan string, channelBuffer)
+	stop := newStopSignal()
+	ain, astop := startBranch(z.a, arg, aout, stop, e)
+	bin, bstop := startBranch(z.b, arg, bout, stop, e)
+	fanned := make(chan struct{})
+	go func() {
+		fanOut(arg.In, []chan string{ain, bin}, []*stopSignal{astop, bstop}, nil)
+		close(fanned)
+	}()
+	defer func() {
+		stop.raise()
+		for range aout {
+		}
+		for range bout {
+		}
+		<-fanned
+	}()
+	for {
+		a, aok := <-aout
+		b, bok := <-bout
+		if !aok && !bok || z.shortest && (!aok || !bok) {
+			break
+		}
+		arg.Out <- z.join(a, b)
+	}
+	return e.getError()
+}
+
+// Partition passes every input item x for which pred(x) is true to
+// matched and every other item to unmatched. The two filters run
+// concurrently, and their outputs are interleaved in the order in
+// which they are produced. A nil filter passes its items through
+// unchanged. E.g., the following compresses all files under dir that
+// are not compressed yet, and emits the names of all compressed files:
+//
+//	stream.Run(
+//		stream.Find(dir).IfMode(os.FileMode.IsRegular),
+//		stream.Partition(
+//			func(s string) bool { return strings.HasSuffix(s, ".gz") },
+//			nil,
+//			stream.Sequence(stream.Xargs("gzip"), stream.Map(...)),
+//		),
+//		...
+//	)
+func Partition(pred func(string) bool, matched, unmatched Filter) Filter {
+	return FilterFunc(func(arg Arg) error {
+		e := &filterErrors{}
+		var wg sync.WaitGroup
+		var ins [2]chan string
+		var stops [2]*stopSignal
+		for i, f := range []Filter{matched, unmatched} {
+			if f == nil {
+				f = Cat()
+			}
+			out := make(chan string, channelBuffer)
+			ins[i], stops[i] = startBranch(f, arg, out, arg.outStop, e)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for s := range out {
+					arg.Out <- s
+				}
+			}()
+		}
+		for s := range arg.In {
+			i := 1
+			if pred(s) {
+				i = 0
+			}
+			select {
+			case ins[i] <- s:
+			case <-stops[i].done(): // Item is not wanted
+			}
+		}
+		close(ins[0])
+		close(ins[1])
+		wg.Wait()
+		return e.getError()
+	})
+}
+
+// Concat ignores its input and runs filters one after the other, each
+// with an empty input, emitting the output of the first filter,
+// followed by the output of the second filter, and so on. Unlike
+// Sequence, the filters are not connected to each other, and unlike
+// Merge, a filter is not started before the previous one has
+// finished. E.g., the following lists the lines of a header file
+// followed by the files in dir:
+//
+//	stream.Run(
+//		stream.Concat(stream.Cat("header.txt"), stream.Find(dir)),
+//		stream.WriteLines(os.Stdout),
+//	)
+//
+// Concat stops at the first filter that fails and returns its error.
+func Concat(filters ...Filter) Filter {
+	return FilterFunc(func(arg Arg) error {
+		for _, f := range filters {
+			var serr error
+			err := forEachWhile(arg.env, f, func(s string) bool {
+				serr = arg.Send(s)
+				return serr == nil
+			})
+			if err != nil {
+				return err
+			}
+			if serr != nil {
+				return serr
+			}
+		}
+		return nil
+	})
+}
+
+// RouteFilter is a Filter that dispatches every item to one of several
+// filters depending on which regular expression it matches.
+type RouteFilter struct {
+	patterns []string
+	filters  []Filter
+	fallback Filter
+}
+
+// Route sends every input item to the filter of the first pattern
+// that it matches, where the patterns are regular expressions. The
+// patterns in routes are tried in lexicographic order, followed by
+// the patterns added by Case in the order in which they were added;
+// when patterns overlap, pass nil for routes and use Case to control
+// which one wins. The filters run concurrently and their outputs are
+// interleaved in the order in which they are produced. A nil filter
+// passes its items through unchanged. Items that match no pattern
+// are dropped unless Default is called. E.g., the following prints
+// all errors in a log, the first ten warnings (including "WARNING"
+// lines), and the first line of every other kind that starts with W:
+//
+//	stream.Run(
+//		stream.Cat("server.log"),
+//		stream.Route(nil).
+//			Case(`^ERROR`, nil).
+//			Case(`^WARN`, stream.First(10)).
+//			Case(`^W`, stream.First(1)),
+//		stream.WriteLines(os.Stdout),
+//	)
+func Route(routes map[string]Filter) *RouteFilter {
+	r := &RouteFilter{}
+	for _, p := range slices.Sorted(maps.Keys(routes)) {
+		r.Case(p, routes[p])
+	}
+	return r
+}
+
+// Case adjusts r so that items that match pattern, and none of the
+// patterns before it, are sent to f (or passed through unchanged if f
+// is nil).
+func (r *RouteFilter) Case(pattern string, f Filter) *RouteFilter {
+	r.patterns = append(r.patterns, pattern)
+	r.filters = append(r.filters, f)
+	return r
+}
+
+// Default adjusts r so that items that match no pattern are sent to f
+// (or passed through unchanged if f is nil) instead of being dropped.
+func (r *RouteFilter) Default(f Filter) *RouteFilter {
+	if f == nil {
+		f = Cat()
+	}
+	r.fallback = f
+	return r
+}
+
+// RunFilter dispatches the input items. It implements the Filter
+// interface.
+func (r *RouteFilter) RunFilter(arg Arg) error {
+	res := make([]*regexp.Regexp, len(r.patterns))
+	for i, p := range r.patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		res[i] = re
+	}
+	filters := r.filters
+	if r.fallback != nil {
+		filters = append(slices.Clip(filters), r.fallback)
+	}
+
+	e := &filterErrors{}
+	var wg sync.WaitGroup
+	ins, stops := make([]chan string, len(filters)), make([]*stopSignal, len(filters))
+	for i, f := range filters {
+		if f == nil {
+			f = Cat()
+		}
+		out := make(chan string, channelBuffer)
+		ins[i], stops[i] = startBranch(f, arg, out, arg.outStop, e)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range out {
+				arg.Out <- s
+			}
+		}()
+	}
+	for s := range arg.In {
+		i := slices.IndexFunc(res, func(re *regexp.Regexp) bool { return re.MatchString(s) })
+		if i < 0 {
+			if r.fallback == nil {
+				continue
+			}
+			i = len(res)
+		}
+		select {
+		case ins[i] <- s:
+		case <-stops[i].done(): // Item is not wanted
+		}
+	}
+	for _, c := range ins {
+		close(c)
+	}
+	wg.Wait()
+	return e.getError()
+}
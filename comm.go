@@ -0,0 +1,103 @@
+package stream
+
+import "strings"
+
+// CommFilter is a Filter that compares its sorted input with the
+// sorted output of another filter.
+type CommFilter struct {
+	other Filter
+	show  [3]bool // Show items only in input, only in other, in both
+}
+
+// Comm returns a filter that compares its input with the output of
+// other, like the comm command. Both must be sorted
+// lexicographically. By default, the filter yields every item, with
+// items that only occur in other preceded by a tab, and items that
+// occur in both preceded by two tabs. The output can be restricted by
+// calling OnlyInInput, OnlyInOther, and InBoth. E.g., to list files
+// in dir1 that are not in dir2 (like "comm -23"):
+//
+//	stream.Run(
+//		stream.Find(dir1).Relative(),
+//		stream.Sort(),
+//		stream.Comm(stream.Sequence(stream.Find(dir2).Relative(), stream.Sort())).OnlyInInput(),
+//		stream.WriteLines(os.Stdout),
+//	)
+func Comm(other Filter) *CommFilter {
+	return &CommFilter{other: other}
+}
+
+// OnlyInInput adjusts c to yield items that only occur in its input.
+// Calls to OnlyInInput, OnlyInOther, and InBoth can be combined; only
+// the selected kinds of items are then yielded, and items are only
+// indented by tabs for the selected kinds that precede them.
+func (c *CommFilter) OnlyInInput() *CommFilter {
+	c.show[0] = true
+	return c
+}
+
+// OnlyInOther adjusts c to yield items that only occur in the output
+// of the other filter.
+func (c *CommFilter) OnlyInOther() *CommFilter {
+	c.show[1] = true
+	return c
+}
+
+// InBoth adjusts c to yield items that occur in both its input and
+// the output of the other filter.
+func (c *CommFilter) InBoth() *CommFilter {
+	c.show[2] = true
+	return c
+}
+
+// RunFilter compares the two streams. It implements the Filter
+// interface.
+func (c *CommFilter) RunFilter(arg Arg) error {
+	show := c.show
+	if show == [3]bool{} {
+		show = [3]bool{true, true, true}
+	}
+	var prefix [3]string
+	tabs := 0
+	for i, ok := range show {
+		prefix[i] = strings.Repeat("\t", tabs)
+		if ok {
+			tabs++
+		}
+	}
+	emit := func(col int, s string) {
+		if show[col] {
+			arg.Out <- prefix[col] + s
+		}
+	}
+
+	in := make(chan string)
+	close(in)
+	other := make(chan string, channelBuffer)
+	e := &filterErrors{}
+	go runFilter(c.other, Arg{In: in, Out: other, env: arg.env}, e)
+
+	a, aok := <-arg.In
+	b, bok := <-other
+	for aok && bok {
+		switch {
+		case a < b:
+			emit(0, a)
+			a, aok = <-arg.In
+		case a > b:
+			emit(1, b)
+			b, bok = <-other
+		default:
+			emit(2, a)
+			a, aok = <-arg.In
+			b, bok = <-other
+		}
+	}
+	for ; aok; a, aok = <-arg.In {
+		emit(0, a)
+	}
+	for ; bok; b, bok = <-other {
+		emit(1, b)
+	}
+	return e.getError()
+}
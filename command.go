@@ -1,33 +1,201 @@
 package stream
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"time"
 )
 
+// CommandFilter is a Filter that executes a command, feeding its
+// input to the command and yielding the command's output.
+type CommandFilter struct {
+	command string
+	args    []string
+	env     []string
+	dir     string
+	stdin   io.Reader
+	stderr  io.Writer
+	merge   bool // Merge stderr into the output
+	capture bool // Capture stderr into the returned error
+	allow   []int
+	timeout time.Duration
+	split   bufio.SplitFunc
+}
+
 // Command executes "command args...".
 //
 // The filter's input items are fed as standard input to the command,
 // one line per input item. The standard output of the command is
 // split into lines and the lines form the output of the filter (with
-// trailing newlines removed).
-func Command(command string, args ...string) Filter {
-	return FilterFunc(func(arg Arg) error {
-		cmd := exec.Command(command, args...)
-		input, err := cmd.StdinPipe()
+// trailing newlines removed). The execution environment of the
+// command can be adjusted by calling CommandFilter methods.
+func Command(command string, args ...string) *CommandFilter {
+	return &CommandFilter{command: command, args: args, split: bufio.ScanLines}
+}
+
+// Shell returns a filter that executes script using "/bin/sh -c".
+// As with Command, the filter's input items are fed as standard
+// input to the shell and its standard output forms the output of the
+// filter. E.g.,
+//
+//	stream.Shell("grep foo | sort -u")
+//
+// The returned filter can be adjusted like any other CommandFilter.
+func Shell(script string) *CommandFilter {
+	return ShellWith("/bin/sh", script)
+}
+
+// ShellWith is like Shell, but executes script using "shell -c".
+func ShellWith(shell, script string) *CommandFilter {
+	return Command(shell, "-c", script)
+}
+
+// Env adjusts c so that the command runs with environment variable
+// key set to value. The rest of the environment is inherited from
+// the current process.
+func (c *CommandFilter) Env(key, value string) *CommandFilter {
+	c.env = append(c.env, key+"="+value)
+	return c
+}
+
+// Dir adjusts c so that the command runs in directory dir instead of
+// the current directory.
+func (c *CommandFilter) Dir(dir string) *CommandFilter {
+	c.dir = dir
+	return c
+}
+
+// Stdin adjusts c so that the standard input of the command is read
+// from r. The input items of the filter are discarded.
+func (c *CommandFilter) Stdin(r io.Reader) *CommandFilter {
+	c.stdin = r
+	return c
+}
+
+// Stderr adjusts c so that the standard error of the command is
+// written to w. By default, the standard error of the command is
+// discarded.
+func (c *CommandFilter) Stderr(w io.Writer) *CommandFilter {
+	c.stderr, c.merge, c.capture = w, false, false
+	return c
+}
+
+// MergeStderr adjusts c so that the standard error of the command is
+// split into lines that are emitted along with the lines from its
+// standard output (like "2>&1" in the shell).
+func (c *CommandFilter) MergeStderr() *CommandFilter {
+	c.stderr, c.merge, c.capture = nil, true, false
+	return c
+}
+
+// CaptureStderr adjusts c so that the standard error of the command
+// is collected and, if the command fails, included in the *ExitError
+// returned by the filter.
+func (c *CommandFilter) CaptureStderr() *CommandFilter {
+	c.stderr, c.merge, c.capture = nil, false, true
+	return c
+}
+
+// AllowExitCodes adjusts c so that the listed non-zero exit statuses
+// are not treated as failures. E.g., grep exits with status 1 if it
+// finds no matches:
+//
+//	stream.Command("grep", "foo").AllowExitCodes(1)
+//
+// Other non-zero exit statuses cause the filter to return an
+// *ExitError.
+func (c *CommandFilter) AllowExitCodes(codes ...int) *CommandFilter {
+	c.allow = append(c.allow, codes...)
+	return c
+}
+
+// SplitNul adjusts c so that the standard output of the command is
+// split into NUL-terminated items instead of lines. This allows
+// items that contain newlines to be read from commands like
+// "find -print0" and "git ls-files -z".
+func (c *CommandFilter) SplitNul() *CommandFilter {
+	c.split = scanNulTerminated
+	return c
+}
+
+// Timeout adjusts c so that the command (along with any processes it
+// started in the same process group) is killed if it runs for longer
+// than d. The filter then fails with an error that wraps
+// context.DeadlineExceeded. The command is killed in the same way
+// if the context of the pipeline (see Arg.Context) is done.
+func (c *CommandFilter) Timeout(d time.Duration) *CommandFilter {
+	c.timeout = d
+	return c
+}
+
+// RunFilter executes the command. It implements the Filter interface.
+func (c *CommandFilter) RunFilter(arg Arg) error {
+	ctx := arg.Context()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	if ctx.Done() != nil {
+		killProcessGroupOnCancel(cmd)
+	}
+	cmd.Dir = c.dir
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	var input io.WriteCloser
+	if c.stdin != nil {
+		cmd.Stdin = c.stdin
+	} else {
+		var err error
+		if input, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+	var errbuf bytes.Buffer
+	switch {
+	case c.stderr != nil:
+		cmd.Stderr = c.stderr
+	case c.capture:
+		cmd.Stderr = &errbuf
+	}
+	start := time.Now()
+	var output io.ReadCloser
+	if c.merge {
+		r, w, err := os.Pipe()
 		if err != nil {
 			return err
 		}
-		output, err := cmd.StdoutPipe()
+		cmd.Stdout, cmd.Stderr = w, w
+		err = cmd.Start()
+		w.Close() // Only the command writes to the pipe
 		if err != nil {
+			r.Close()
+			return err
+		}
+		defer r.Close()
+		output = r
+	} else {
+		var err error
+		if output, err = cmd.StdoutPipe(); err != nil {
 			return err
 		}
 		if err := cmd.Start(); err != nil {
 			return err
 		}
-		var ierr error // Records error writing to command input
-		var wg sync.WaitGroup
+	}
+	var ierr error // Records error writing to command input
+	var wg sync.WaitGroup
+	if input != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -40,16 +208,207 @@ func Command(command string, args ...string) Filter {
 			}
 			ierr = input.Close()
 		}()
-		if err := splitIntoLines(output, arg); err != nil {
-			wg.Wait()
-			cmd.Wait()
-			return err
+	}
+	if err := splitIntoItems(output, arg, c.split); err != nil {
+		// Nobody is reading the output, so the command must be
+		// killed to ensure it exits.
+		if cmd.Cancel != nil {
+			cmd.Cancel()
+		} else {
+			cmd.Process.Kill()
 		}
-		err = cmd.Wait()
 		wg.Wait()
-		if err != nil {
-			return err
+		logExit(arg, cmd, start, cmd.Wait())
+		return err
+	}
+	err := cmd.Wait()
+	wg.Wait()
+	logExit(arg, cmd, start, err)
+	if ctx.Err() != nil {
+		return fmt.Errorf("stream.Command: %s: %w", c.command, ctx.Err())
+	}
+	if x, ok := err.(*exec.ExitError); ok {
+		if c.allowed(x.ExitCode()) {
+			return nil // Input errors are expected if the command exited early
+		}
+		return &ExitError{
+			Command: c.command,
+			Args:    c.args,
+			Code:    x.ExitCode(),
+			Stderr:  string(bytes.TrimSpace(errbuf.Bytes())),
+			err:     x,
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ierr
+}
+
+// logExit logs the exit of cmd, which was started at start and
+// returned err from Wait, at level Debug.
+func logExit(arg Arg, cmd *exec.Cmd, start time.Time, err error) {
+	logger := arg.Logger()
+	if !logger.Enabled(arg.Context(), slog.LevelDebug) {
+		return
+	}
+	logger.Debug("stream: command exited",
+		"command", cmd.Path,
+		"args", cmd.Args[1:],
+		"pid", cmd.Process.Pid,
+		"code", cmd.ProcessState.ExitCode(),
+		"elapsed", time.Since(start),
+		"err", err)
+}
+
+// allowed returns true if exit status code does not indicate failure.
+func (c *CommandFilter) allowed(code int) bool {
+	for _, a := range c.allow {
+		if a == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitError is the error returned by a filter when a command it
+// executes exits with a status that indicates failure.
+type ExitError struct {
+	Command string   // The command that was executed
+	Args    []string // The arguments passed to the command
+	Code    int      // The exit status, or -1 if killed by a signal
+	Stderr  string   // Standard error of the command, if captured
+	err     error
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Command, e.err)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+// Unwrap returns the underlying *exec.ExitError.
+func (e *ExitError) Unwrap() error { return e.err }
+
+// CommandEachFilter is a Filter that executes a command once per
+// input item.
+type CommandEachFilter struct {
+	command string
+	args    []string
+	n       int
+	quote   bool
+}
+
+// CommandEach returns a filter that executes "command args..." once
+// for every input item, with every occurrence of "{}" in args
+// replaced by the item. E.g.,
+//
+//	stream.CommandEach("convert", "{}", "{}.png")
+//
+// converts every input file to PNG format. The standard output of
+// each execution is split into lines and the lines form the output
+// of the filter. Output lines from a single execution are kept
+// together.
+func CommandEach(command string, args ...string) *CommandEachFilter {
+	return &CommandEachFilter{command: command, args: args, n: 1}
+}
+
+// Parallel adjusts c so that up to n executions of the command run
+// concurrently. The output of the executions is merged in an
+// unspecified order. A value of n less than 1 is treated as 1.
+func (c *CommandEachFilter) Parallel(n int) *CommandEachFilter {
+	c.n = n
+	return c
+}
+
+// QuoteItems adjusts c so that when an item is substituted into an
+// argument that contains more than just "{}", the item is quoted for
+// a POSIX shell (see ShellQuote). This makes it safe to substitute
+// untrusted items into shell scripts. E.g.,
+//
+//	stream.CommandEach("sh", "-c", "wc -l {} | sort").QuoteItems()
+func (c *CommandEachFilter) QuoteItems() *CommandEachFilter {
+	c.quote = true
+	return c
+}
+
+// RunFilter executes the command for every input item. It implements
+// the Filter interface. An execution that fails is handled by the
+// error policy of the pipeline (see OnError): by default, the filter
+// fails with an *ExitError.
+func (c *CommandEachFilter) RunFilter(arg Arg) error {
+	// ctx is canceled as soon as the filter fails, which kills the
+	// executions in progress and stops new ones from starting.
+	ctx, cancel := context.WithCancel(arg.Context())
+	defer cancel()
+	var e filterErrors
+	fail := func(err error) {
+		e.record(err)
+		cancel()
+	}
+	n := max(c.n, 1)
+	var mu sync.Mutex // Serializes output from concurrent executions
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for s := range arg.In {
+				if ctx.Err() != nil {
+					return
+				}
+				out, err := c.execute(ctx, s)
+				if err != nil && ctx.Err() != nil {
+					if err := arg.Context().Err(); err != nil {
+						fail(fmt.Errorf("stream.CommandEach: %s: %w", c.command, err))
+					}
+					return // Otherwise another execution already failed
+				}
+				mu.Lock()
+				if err != nil {
+					err = arg.Fail(s, err)
+				} else {
+					err = splitIntoLines(bytes.NewReader(out), arg)
+				}
+				mu.Unlock()
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return e.getError()
+}
+
+// execute runs the command for item s under ctx and returns its
+// standard output.
+func (c *CommandEachFilter) execute(ctx context.Context, s string) ([]byte, error) {
+	args := make([]string, len(c.args))
+	for j, a := range c.args {
+		switch {
+		case a == "{}":
+			args[j] = s
+		case c.quote:
+			args[j] = strings.ReplaceAll(a, "{}", shellQuote(s))
+		default:
+			args[j] = strings.ReplaceAll(a, "{}", s)
+		}
+	}
+	cmd := exec.CommandContext(ctx, c.command, args...)
+	killProcessGroupOnCancel(cmd)
+	out, err := cmd.Output()
+	if x, ok := err.(*exec.ExitError); ok {
+		return out, &ExitError{
+			Command: c.command,
+			Args:    args,
+			Code:    x.ExitCode(),
+			Stderr:  string(bytes.TrimSpace(x.Stderr)),
+			err:     x,
 		}
-		return ierr
-	})
+	}
+	return out, err
 }
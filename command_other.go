@@ -0,0 +1,10 @@
+//go:build !unix
+
+package stream
+
+import "os/exec"
+
+// killProcessGroupOnCancel does nothing since process groups are not
+// supported on this platform. Only cmd itself is killed when its
+// context is done.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
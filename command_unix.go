@@ -0,0 +1,18 @@
+//go:build unix
+
+package stream
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel arranges for cmd to run in a new process
+// group that is killed in its entirety when cmd's context is done, so
+// that children started by cmd are not left running.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PipelineConfig is a declarative description of a pipeline. It is
+// typically decoded from JSON by LoadPipeline, e.g.,
+//
+//	{"stages": [
+//		{"filter": "find", "args": ["/var/log"]},
+//		{"filter": "grep", "args": ["\\.log$"]},
+//		{"filter": "xargs", "args": ["wc", "-l"], "name": "count"},
+//		{"filter": "sort", "args": ["-nr", 1]},
+//		{"filter": "first", "args": [10]}
+//	]}
+type PipelineConfig struct {
+	Stages []StageConfig `json:"stages"`
+}
+
+// StageConfig describes one stage of a PipelineConfig. Filter names a
+// filter known to Parse (see RegisterFilter), and Args are passed to
+// it. Numeric and boolean arguments are converted to strings. If Name
+// is not empty, the stage is wrapped using Named.
+type StageConfig struct {
+	Filter string `json:"filter"`
+	Args   []any  `json:"args,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// LoadPipeline reads a JSON encoded PipelineConfig from r and returns
+// the filter it describes.
+func LoadPipeline(r io.Reader) (Filter, error) {
+	var c PipelineConfig
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("stream.LoadPipeline: %v", err)
+	}
+	f, err := c.Build()
+	if err != nil {
+		return nil, fmt.Errorf("stream.LoadPipeline: %v", err)
+	}
+	return f, nil
+}
+
+// Build returns the filter described by c.
+func (c *PipelineConfig) Build() (Filter, error) {
+	if len(c.Stages) == 0 {
+		return nil, fmt.Errorf("no stages")
+	}
+	filters := make([]Filter, len(c.Stages))
+	for i, st := range c.Stages {
+		fn, ok := lookupFilter(st.Filter)
+		if !ok {
+			return nil, fmt.Errorf("stage %d: unknown filter %q", i+1, st.Filter)
+		}
+		args := make([]string, len(st.Args))
+		for j, a := range st.Args {
+			switch v := a.(type) {
+			case string:
+				args[j] = v
+			case float64:
+				args[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				args[j] = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("stage %d: %s: unsupported argument %v", i+1, st.Filter, a)
+			}
+		}
+		f, err := fn(args)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %s: %v", i+1, st.Filter, err)
+		}
+		if st.Name != "" {
+			f = Named(st.Name, f)
+		}
+		filters[i] = f
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return Sequence(filters...), nil
+}
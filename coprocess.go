@@ -0,0 +1,176 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CoprocessFilter is a Filter that feeds each input item to a single
+// long-running helper process and yields the helper's response to
+// each item.
+type CoprocessFilter struct {
+	command  string
+	args     []string
+	restarts int
+	backoff  time.Duration
+}
+
+// Coprocess returns a filter that starts "command args..." once and
+// keeps it running while the filter runs. Each input item is written
+// to the standard input of the command followed by a newline, and
+// the next line read from the standard output of the command (with
+// the trailing newline removed) is yielded. The command must
+// therefore produce exactly one line of output per line of input,
+// and must flush its output after every line. An item that contains
+// a newline cannot be sent to the command: it is handled by the error
+// policy of the pipeline (see OnError).
+//
+// If the command dies, it is restarted and the item that was being
+// processed is retried. By default, up to three restarts are made,
+// waiting 100ms before the first restart and doubling the wait for
+// each subsequent restart. This can be adjusted by calling
+// CoprocessFilter methods. The command (along with any processes it
+// started in the same process group) is killed if the context of the
+// pipeline (see Arg.Context) is done.
+func Coprocess(command string, args ...string) *CoprocessFilter {
+	return &CoprocessFilter{
+		command:  command,
+		args:     args,
+		restarts: 3,
+		backoff:  100 * time.Millisecond,
+	}
+}
+
+// Restarts adjusts c so that the command is restarted at most n times
+// in a row before the filter fails. The count is reset every time an
+// item is processed successfully.
+func (c *CoprocessFilter) Restarts(n int) *CoprocessFilter {
+	c.restarts = n
+	return c
+}
+
+// Backoff adjusts c so that it waits for d before the first restart
+// of the command. The wait doubles for every subsequent consecutive
+// restart.
+func (c *CoprocessFilter) Backoff(d time.Duration) *CoprocessFilter {
+	c.backoff = d
+	return c
+}
+
+// coprocess is a running instance of the command.
+type coprocess struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+// start starts the command, which is killed along with any processes
+// it started if ctx is done.
+func (c *CoprocessFilter) start(ctx context.Context) (*coprocess, error) {
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	killProcessGroupOnCancel(cmd)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &coprocess{cmd, in, bufio.NewReader(out)}, nil
+}
+
+// call sends s to p and returns the response.
+func (p *coprocess) call(s string) (string, error) {
+	if _, err := io.WriteString(p.in, s+"\n"); err != nil {
+		return "", err
+	}
+	line, err := p.out.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// kill stops p, which has stopped working.
+func (p *coprocess) kill() {
+	if p.cmd.Cancel != nil {
+		p.cmd.Cancel()
+	} else {
+		p.cmd.Process.Kill()
+	}
+	p.cmd.Wait()
+}
+
+// RunFilter feeds all input items to the command. It implements the
+// Filter interface.
+func (c *CoprocessFilter) RunFilter(arg Arg) error {
+	ctx := arg.Context()
+	p, err := c.start(ctx)
+	if err != nil {
+		return err
+	}
+	for s := range arg.In {
+		if strings.Contains(s, "\n") {
+			err := fmt.Errorf("stream.Coprocess: item contains a newline")
+			if err := arg.Fail(s, err); err != nil {
+				p.kill()
+				return err
+			}
+			continue
+		}
+		failures := 0
+		wait := c.backoff
+		for {
+			r, err := p.call(s)
+			if err == nil {
+				arg.Out <- r
+				break
+			}
+			p.kill()
+			if ctx.Err() != nil {
+				return fmt.Errorf("stream.Coprocess: %s: %w", c.command, ctx.Err())
+			}
+			if failures >= c.restarts {
+				return fmt.Errorf("stream.Coprocess: %s failed after %d restarts: %v",
+					c.command, failures, err)
+			}
+			failures++
+			if err := sleep(arg, wait); err != nil {
+				return fmt.Errorf("stream.Coprocess: %s: %w", c.command, err)
+			}
+			wait *= 2
+			if p, err = c.start(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// sleep waits for d according to the clock of arg. It returns early
+// with the context's error if the context of arg is done first.
+func sleep(arg Arg, d time.Duration) error {
+	ctx := arg.Context()
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := arg.Clock().NewTicker(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// DebugFilter is a Filter that passes its input through unchanged
+// while describing every item it sees.
+type DebugFilter struct {
+	label   string
+	w       io.Writer
+	layout  string
+	enabled bool
+}
+
+// Debug returns a filter that copies its input to its output and
+// writes a line of the form
+//
+//	label #seq time item
+//
+// to standard error for every item, where seq is the sequence number
+// of the item (starting at 1) and time is the time at which the item
+// was seen. Debug can be inserted at any point in a pipeline to see
+// what is flowing through that point. E.g.,
+//
+//	stream.Run(
+//		stream.Find("."),
+//		stream.Debug("found"),
+//		stream.Grep(`\.go$`),
+//		stream.Debug("grepped").Enabled(*verbose),
+//		...
+//	)
+func Debug(label string) *DebugFilter {
+	return &DebugFilter{
+		label:   label,
+		w:       os.Stderr,
+		layout:  "15:04:05.000000",
+		enabled: true,
+	}
+}
+
+// To adjusts d so that descriptions are written to w instead of
+// standard error.
+func (d *DebugFilter) To(w io.Writer) *DebugFilter {
+	d.w = w
+	return d
+}
+
+// TimeFormat adjusts d so that times are formatted using layout (see
+// time.Time.Format). If layout is empty, times are omitted.
+func (d *DebugFilter) TimeFormat(layout string) *DebugFilter {
+	d.layout = layout
+	return d
+}
+
+// Enabled adjusts d so that descriptions are only written if on is
+// true. A disabled DebugFilter just copies its input to its output.
+func (d *DebugFilter) Enabled(on bool) *DebugFilter {
+	d.enabled = on
+	return d
+}
+
+// RunFilter copies input to output, describing every item. It
+// implements the Filter interface.
+func (d *DebugFilter) RunFilter(arg Arg) error {
+	seq := 0
+	for s := range arg.In {
+		if d.enabled {
+			seq++
+			if d.layout == "" {
+				fmt.Fprintf(d.w, "%s #%d %s\n", d.label, seq, s)
+			} else {
+				fmt.Fprintf(d.w, "%s #%d %s %s\n", d.label, seq, arg.Clock().Now().Format(d.layout), s)
+			}
+		}
+		arg.Out <- s
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DecodeText returns a reader that yields the contents of r as UTF-8.
+// A leading byte order mark is removed. If the byte order mark
+// indicates UTF-16 (as commonly written by Windows tools), the rest of
+// r is decoded from UTF-16 in the indicated byte order; invalid UTF-16
+// is replaced by utf8.RuneError. Text without a byte order mark is
+// passed through unchanged. Use it to wrap the argument of ReadLines:
+//
+//	stream.ReadLines(stream.DecodeText(os.Stdin))
+func DecodeText(r io.Reader) io.Reader {
+	return &textDecoder{r: bufio.NewReader(r)}
+}
+
+// textDecoder is the reader returned by DecodeText. The byte order
+// mark is examined on the first call to Read so that DecodeText never
+// blocks.
+type textDecoder struct {
+	r       *bufio.Reader
+	sniffed bool
+	order   binary.ByteOrder // Nil unless decoding UTF-16
+	pending []byte           // Encoded rune that did not fit in the last Read
+}
+
+func (d *textDecoder) Read(p []byte) (int, error) {
+	if !d.sniffed {
+		d.sniffed = true
+		d.sniff()
+	}
+	if d.order == nil {
+		return d.r.Read(p)
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	var buf [utf8.UTFMax]byte
+	for n < len(p) {
+		if n > 0 && d.r.Buffered() < 2 {
+			break // Do not block while holding decoded text
+		}
+		r, err := d.next()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		size := utf8.EncodeRune(buf[:], r)
+		c := copy(p[n:], buf[:size])
+		d.pending = append(d.pending, buf[c:size]...)
+		n += c
+	}
+	return n, nil
+}
+
+// sniff removes a byte order mark from the front of d.r and records
+// the encoding it indicates.
+func (d *textDecoder) sniff() {
+	b, _ := d.r.Peek(2)
+	switch {
+	case len(b) < 2:
+	case b[0] == 0xFE && b[1] == 0xFF:
+		d.order = binary.BigEndian
+		d.r.Discard(2)
+	case b[0] == 0xFF && b[1] == 0xFE:
+		d.order = binary.LittleEndian
+		d.r.Discard(2)
+	case b[0] == 0xEF && b[1] == 0xBB:
+		if b, _ := d.r.Peek(3); len(b) == 3 && b[2] == 0xBF {
+			d.r.Discard(3)
+		}
+	}
+}
+
+// next decodes the next rune from UTF-16 input.
+func (d *textDecoder) next() (rune, error) {
+	b, err := d.r.Peek(2)
+	if len(b) < 2 {
+		if len(b) == 1 {
+			d.r.Discard(1) // Truncated code unit
+			return utf8.RuneError, nil
+		}
+		return 0, err
+	}
+	r1 := rune(d.order.Uint16(b))
+	d.r.Discard(2)
+	if !utf16.IsSurrogate(r1) {
+		return r1, nil
+	}
+	if b, _ := d.r.Peek(2); len(b) == 2 {
+		r2 := rune(d.order.Uint16(b))
+		if r := utf16.DecodeRune(r1, r2); r != utf8.RuneError {
+			d.r.Discard(2)
+			return r, nil
+		}
+	}
+	return utf8.RuneError, nil
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+)
+
+// DedupFilter is a Filter that removes duplicate items.
+type DedupFilter struct {
+	key      func(string) string
+	expected int     // Expected number of distinct items, if approximate
+	fpRate   float64 // Acceptable false positive rate, if approximate
+	limit    int64   // Bytes of keys remembered; 0 means unlimited
+}
+
+// Dedup returns a filter that yields the first occurrence of every
+// distinct item and drops later duplicates, wherever they occur.
+// Unlike Sort followed by Uniq, the order of items is preserved and
+// output is produced as soon as possible. Every distinct item is held
+// in memory (see MemoryBudget).
+func Dedup() *DedupFilter {
+	return &DedupFilter{}
+}
+
+// By adjusts d so that two items are duplicates if key returns the
+// same value for them. Only the keys are held in memory.
+func (d *DedupFilter) By(key func(string) string) *DedupFilter {
+	d.key = key
+	return d
+}
+
+// Approximate adjusts d so that it uses a fixed amount of memory
+// instead of remembering every distinct item. The memory is sized
+// for expectedItems distinct items, such that a distinct item is
+// wrongly treated as a duplicate (and dropped) with probability
+// falsePositiveRate. If more distinct items occur, the probability
+// rises. Duplicates are always dropped. E.g., Approximate(1e9, 0.001)
+// uses about 1.8GB of memory. Approximate cannot be combined with
+// MemoryLimit: the filter then fails.
+func (d *DedupFilter) Approximate(expectedItems int, falsePositiveRate float64) *DedupFilter {
+	d.expected, d.fpRate = expectedItems, falsePositiveRate
+	return d
+}
+
+// MemoryLimit adjusts d so that it remembers at most n bytes of
+// distinct items (or keys, see By). Once the limit is reached, the
+// oldest items are forgotten, so that an item is only dropped if a
+// duplicate occurred recently enough. This bounds the memory used on
+// unbounded inputs, where most duplicates are close together, such
+// as log streams. MemoryLimit cannot be combined with Approximate:
+// the filter then fails.
+func (d *DedupFilter) MemoryLimit(n int64) *DedupFilter {
+	d.limit = n
+	return d
+}
+
+// RunFilter removes duplicates. It implements the Filter interface.
+func (d *DedupFilter) RunFilter(arg Arg) error {
+	if d.expected > 0 && d.limit > 0 {
+		return fmt.Errorf("stream.Dedup: Approximate and MemoryLimit cannot be combined")
+	}
+	if d.expected > 0 {
+		return d.runApproximate(arg)
+	}
+	seen := map[string]bool{}
+	var order []string // Remembered keys, oldest first, if limited
+	var reserved int64
+	defer func() { arg.Release(reserved) }()
+	for s := range arg.In {
+		k := s
+		if d.key != nil {
+			k = d.key(s)
+		}
+		if seen[k] {
+			continue
+		}
+		if err := arg.Reserve(itemSize(k)); err != nil {
+			return err
+		}
+		reserved += itemSize(k)
+		seen[k] = true
+		if d.limit > 0 {
+			order = append(order, k)
+			for reserved > d.limit && len(order) > 1 {
+				old := order[0]
+				order[0] = ""
+				order = order[1:]
+				delete(seen, old)
+				arg.Release(itemSize(old))
+				reserved -= itemSize(old)
+			}
+		}
+		arg.Out <- s
+	}
+	return nil
+}
+
+// runApproximate removes duplicates using a Bloom filter.
+func (d *DedupFilter) runApproximate(arg Arg) error {
+	if d.fpRate <= 0 || d.fpRate >= 1 {
+		return fmt.Errorf("stream.Dedup: false positive rate %v not in (0, 1)", d.fpRate)
+	}
+	b := newBloomFilter(d.expected, d.fpRate)
+	size := int64(len(b.bits) * 8)
+	if err := arg.Reserve(size); err != nil {
+		return err
+	}
+	defer arg.Release(size)
+	for s := range arg.In {
+		k := s
+		if d.key != nil {
+			k = d.key(s)
+		}
+		if b.add(k) {
+			arg.Out <- s
+		}
+	}
+	return nil
+}
+
+// bloomFilter is a set of strings that may report false positives.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64 // Number of bits
+	k      int    // Number of hash functions
+	s1, s2 maphash.Seed
+}
+
+// newBloomFilter returns a Bloom filter sized for n items with false
+// positive rate p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	words := (uint64(m) + 63) / 64
+	return &bloomFilter{
+		bits: make([]uint64, words),
+		m:    words * 64,
+		k:    max(k, 1),
+		s1:   maphash.MakeSeed(),
+		s2:   maphash.MakeSeed(),
+	}
+}
+
+// add adds s to b and returns true if s was not in b before.
+func (b *bloomFilter) add(s string) bool {
+	// Derive k hash functions from two (Kirsch and Mitzenmacher).
+	h1, h2 := maphash.String(b.s1, s), maphash.String(b.s2, s)|1
+	added := false
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+	return added
+}
@@ -0,0 +1,334 @@
+package stream
+
+import "fmt"
+
+// DiffFilter is a Filter that compares its input with the output of
+// another filter and yields the differences.
+type DiffFilter struct {
+	base     Filter // Replaces the input if not nil
+	other    Filter
+	context  int
+	old, new string
+}
+
+// DiffAgainst returns a filter that compares its input with the
+// output of other and yields the differences in the unified format
+// of "diff -u", treating every item as a line. Input items that are
+// missing from the output of other are marked with "-", items that
+// only occur in the output of other are marked with "+". Nothing is
+// yielded if the two sequences are identical. E.g.,
+//
+//	stream.Run(
+//		stream.Cat("inventory.yesterday"),
+//		stream.DiffAgainst(stream.Cat("inventory.today")),
+//		stream.WriteLines(os.Stdout),
+//	)
+//
+// Both sequences are held in memory (see MemoryBudget).
+func DiffAgainst(other Filter) *DiffFilter {
+	return &DiffFilter{other: other, context: 3, old: "input", new: "other"}
+}
+
+// Diff returns a filter that ignores its input and yields the
+// differences between the outputs of a and b in the format used by
+// DiffAgainst. The header lines name the two sequences "a" and "b"
+// unless adjusted by Labels.
+func Diff(a, b Filter) *DiffFilter {
+	return &DiffFilter{base: a, other: b, context: 3, old: "a", new: "b"}
+}
+
+// DiffAgainstFile is like DiffAgainst, but compares the input with
+// the lines of the named file.
+func DiffAgainstFile(filename string) *DiffFilter {
+	return DiffAgainst(Cat(filename)).Labels("input", filename)
+}
+
+// Context adjusts d so that n unchanged items are shown around every
+// change.
+func (d *DiffFilter) Context(n int) *DiffFilter {
+	d.context = n
+	return d
+}
+
+// Labels adjusts d so that the "---" and "+++" header lines name the
+// input and the other sequence old and new.
+func (d *DiffFilter) Labels(old, new string) *DiffFilter {
+	d.old, d.new = old, new
+	return d
+}
+
+// RunFilter yields the differences. It implements the Filter
+// interface.
+func (d *DiffFilter) RunFilter(arg Arg) error {
+	var reserved int64
+	defer func() { arg.Release(reserved) }()
+	collect := func(s string, list *[]string) error {
+		if err := arg.Reserve(itemSize(s)); err != nil {
+			return err
+		}
+		reserved += itemSize(s)
+		*list = append(*list, s)
+		return nil
+	}
+	var a, b []string
+	if d.base == nil {
+		for s := range arg.In {
+			if err := collect(s, &a); err != nil {
+				return err
+			}
+		}
+	} else if err := collectFrom(arg, d.base, &a, collect); err != nil {
+		return err
+	}
+	if err := collectFrom(arg, d.other, &b, collect); err != nil {
+		return err
+	}
+
+	mem := diffMemory(len(a), len(b))
+	if err := arg.Reserve(mem); err != nil {
+		return err
+	}
+	reserved += mem
+	ops := diffLines(a, b)
+	first := true
+	for _, h := range diffHunks(ops, d.context) {
+		if first {
+			arg.Out <- "--- " + d.old
+			arg.Out <- "+++ " + d.new
+			first = false
+		}
+		arg.Out <- h.header()
+		for _, op := range ops[h.start:h.end] {
+			switch op.kind {
+			case '-':
+				arg.Out <- "-" + a[op.a]
+			case '+':
+				arg.Out <- "+" + b[op.b]
+			default:
+				arg.Out <- " " + a[op.a]
+			}
+		}
+	}
+	return nil
+}
+
+// collectFrom passes the output of f to collect.
+func collectFrom(arg Arg, f Filter, list *[]string, collect func(string, *[]string) error) error {
+	var cerr error
+	err := forEach(arg.env, f, func(s string) {
+		if cerr == nil {
+			cerr = collect(s, list)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// diffOp is one step in an edit script that turns a into b: keep a[a]
+// (kind ' '), delete a[a] (kind '-'), or insert b[b] (kind '+'). For
+// every op, a and b are the positions in both sequences.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// diffLines returns a shortest edit script that turns a into b, using
+// the linear space variant of the algorithm from "An O(ND) Difference
+// Algorithm and Its Variations" by Eugene Myers.
+func diffLines(a, b []string) []diffOp {
+	d := &differ{a: a, b: b, ops: make([]diffOp, 0, len(a)+len(b))}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// diffMemory returns an upper bound for the number of bytes used by
+// diffLines for sequences of n and m items.
+func diffMemory(n, m int) int64 {
+	const opSize, intSize = 3 * 8, 8
+	return int64(n+m)*opSize + 2*int64(n+m+2)*intSize
+}
+
+// differ holds the state of diffLines.
+type differ struct {
+	a, b []string
+	ops  []diffOp
+}
+
+// compare appends the edit script that turns a[a0:a1] into b[b0:b1]
+// to d.ops.
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	// Common prefixes and suffixes are kept.
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{' ', a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a1 > a0 && b1 > b0 && d.a[a1-1] == d.b[b1-1] {
+		a1--
+		b1--
+		suffix++
+	}
+	x, y, ok := 0, 0, false
+	if a0 < a1 && b0 < b1 {
+		x, y, ok = d.bisect(a0, a1, b0, b1)
+	}
+	if ok {
+		d.compare(a0, x, b0, y)
+		d.compare(x, a1, y, b1)
+	} else {
+		for i := a0; i < a1; i++ {
+			d.ops = append(d.ops, diffOp{'-', i, b0})
+		}
+		for j := b0; j < b1; j++ {
+			d.ops = append(d.ops, diffOp{'+', a1, j})
+		}
+	}
+	for i := 0; i < suffix; i++ {
+		d.ops = append(d.ops, diffOp{' ', a1 + i, b1 + i})
+	}
+}
+
+// bisect finds the middle snake of a shortest edit script that turns
+// a[a0:a1] into b[b0:b1] by searching forward from the start and
+// backward from the end at the same time, and returns the point
+// (x, y) where the two searches meet, which splits the problem in
+// two. It returns false if the sequences have nothing in common.
+func (d *differ) bisect(a0, a1, b0, b1 int) (x, y int, ok bool) {
+	a, b := d.a[a0:a1], d.b[b0:b1]
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	off := maxD
+	vf := make([]int, 2*maxD+2) // Furthest x on every diagonal, forward
+	vb := make([]int, 2*maxD+2) // Same, backward from the end
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	front := delta%2 != 0 // Whether the forward search detects overlaps
+	// Diagonals that ran off the edges of the grid are skipped.
+	var fstart, fend, bstart, bend int
+	for D := 0; D < maxD; D++ {
+		for k := -D + fstart; k <= D-fend; k += 2 {
+			var x1 int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x1 = vf[off+k+1] // Insertion
+			} else {
+				x1 = vf[off+k-1] + 1 // Deletion
+			}
+			y1 := x1 - k
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			vf[off+k] = x1
+			switch {
+			case x1 > n:
+				fend += 2
+			case y1 > m:
+				fstart += 2
+			case front:
+				if kb := off + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x1 >= n-vb[kb] {
+					return a0 + x1, b0 + y1, true
+				}
+			}
+		}
+		for k := -D + bstart; k <= D-bend; k += 2 {
+			var x2 int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x2 = vb[off+k+1]
+			} else {
+				x2 = vb[off+k-1] + 1
+			}
+			y2 := x2 - k
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			vb[off+k] = x2
+			switch {
+			case x2 > n:
+				bend += 2
+			case y2 > m:
+				bstart += 2
+			case !front:
+				if kf := off + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 {
+					x1 := vf[kf]
+					y1 := off + x1 - kf
+					if x1 >= n-x2 {
+						return a0 + x1, b0 + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// diffHunk is a range of ops[start:end] that is shown together.
+type diffHunk struct {
+	start, end int
+	a, alen    int // Range in the first sequence
+	b, blen    int // Range in the second sequence
+}
+
+func (h diffHunk) header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.a, h.alen), hunkRange(h.b, h.blen))
+}
+
+// hunkRange formats a range of lines starting at index start like
+// "diff -u".
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// diffHunks groups the changes in ops into hunks with context
+// unchanged ops around every change.
+func diffHunks(ops []diffOp, context int) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are close together.
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = next
+		}
+		h := diffHunk{start: start, end: end, a: ops[start].a, b: ops[start].b}
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				h.alen++
+			}
+			if op.kind != '-' {
+				h.blen++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
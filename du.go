@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DiskUsageFilter is a Filter that reports the total size of the files
+// under each input directory.
+type DiskUsageFilter struct {
+	human bool
+}
+
+// DiskUsage returns a filter that treats each input item as a
+// directory and yields "bytes path", where bytes is the sum of the
+// sizes of all files under path (recursively). Symbolic links are not
+// followed. If an input item names a file, the size of the file is
+// reported. E.g., the following pipeline prints the five largest
+// directories directly under /var:
+//
+//	stream.Run(
+//		stream.Find("/var").Prune("^/var/.*/").IfMode(os.FileMode.IsDir),
+//		stream.DiskUsage(),
+//		stream.Sort().NumDecreasing(1),
+//		stream.First(5),
+//		stream.WriteLines(os.Stdout),
+//	)
+func DiskUsage() *DiskUsageFilter {
+	return &DiskUsageFilter{}
+}
+
+// Human adjusts d so that sizes are reported in a human-readable
+// format using powers of 1024 (e.g., 1023, 4.0K, 23M, 1.2G).
+func (d *DiskUsageFilter) Human() *DiskUsageFilter {
+	d.human = true
+	return d
+}
+
+// RunFilter yields the disk usage of every input path. It implements
+// the Filter interface.
+func (d *DiskUsageFilter) RunFilter(arg Arg) error {
+	for s := range arg.In {
+		var total int64
+		err := filepath.Walk(s, func(n string, info os.FileInfo, e error) error {
+			if e != nil {
+				return e
+			}
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			if err := arg.Fail(s, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if d.human {
+			arg.Out <- humanSize(total) + " " + s
+		} else {
+			arg.Out <- fmt.Sprintf("%d %s", total, s)
+		}
+	}
+	return nil
+}
+
+// humanSize formats n using a K, M, G, T, P, or E suffix as
+// appropriate.
+func humanSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprint(n)
+	}
+	v := float64(n)
+	unit := -1
+	for v >= 1024 && unit < len(humanSuffixes)-1 {
+		v /= 1024
+		unit++
+	}
+	if v < 10 {
+		return fmt.Sprintf("%.1f%c", v, humanSuffixes[unit])
+	}
+	return fmt.Sprintf("%.0f%c", v, humanSuffixes[unit])
+}
+
+const humanSuffixes = "KMGTPE"
@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// ItemError records an error encountered while processing a
+// particular input item.
+type ItemError struct {
+	Item string // The item (or for some filters, the file) being processed
+	Err  error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %q: %v", e.Item, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ItemError) Unwrap() error { return e.Err }
+
+// PanicError is the error reported for a filter that panicked. The
+// panic is recovered so that the rest of the pipeline can be shut
+// down normally. Panics in goroutines started by a filter are not
+// recovered.
+type PanicError struct {
+	Filter string // The name of the filter (see Named) or its type
+	Value  any    // The value passed to panic
+	Stack  []byte // The stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// runRecovered calls f.RunFilter(arg) and converts a panic into a
+// *PanicError.
+func runRecovered[T, U any](f StageOf[T, U], arg ArgOf[T, U]) error {
+	return recoverPanic(f, func() error { return f.RunFilter(arg) })
+}
+
+// recoverPanic calls run, which runs filter f, and converts a panic
+// into a *PanicError.
+func recoverPanic(f any, run func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Filter: stageName(f), Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return run()
+}
+
+// StageError is the error returned by a pipeline when one of its
+// top-level stages fails. It identifies the stage that failed.
+type StageError struct {
+	Stage int    // Position of the stage in the pipeline, starting at 1
+	Name  string // Name of the stage (see Named) or of its constructor
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %d (%s): %v", e.Stage, e.Name, e.Err)
+}
+
+// Unwrap returns the error of the stage.
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Action specifies how a pipeline proceeds after a filter fails to
+// process an item. The zero Action is Abort.
+type Action struct {
+	kind    actionKind
+	replace string
+}
+
+type actionKind int
+
+const (
+	abortAction actionKind = iota
+	skipAction
+	replaceAction
+)
+
+var (
+	// Abort stops the pipeline: the filter returns the error.
+	Abort = Action{kind: abortAction}
+
+	// Skip drops the item and continues with the next item.
+	Skip = Action{kind: skipAction}
+)
+
+// ReplaceWith emits s in place of the output for the item and
+// continues with the next item.
+func ReplaceWith(s string) Action {
+	return Action{kind: replaceAction, replace: s}
+}
+
+// OnError arranges for fn to decide what happens when a filter fails
+// to process an item (see Arg.Fail). fn is called with an *ItemError
+// and may be called concurrently from multiple filters. Without this
+// option, every such failure aborts the pipeline.
+func OnError(fn func(err error) Action) RunOption {
+	return func(r *Runner) { r.env.onError = fn }
+}
+
+// Fail is called by a filter that failed to process item because of
+// err. It applies the error policy of the pipeline (see OnError): if
+// the item is to be replaced, the replacement is emitted on a.Out (or
+// dropped if a.Out does not carry strings).
+// Unless the pipeline is aborted, the failure is also passed to
+// Report so that it is not lost. Fail returns nil if the filter
+// should continue with the next item, or an *ItemError that the
+// filter should return from RunFilter. E.g.,
+//
+//	for s := range arg.In {
+//		info, err := os.Stat(s)
+//		if err != nil {
+//			if err := arg.Fail(s, err); err != nil {
+//				return err
+//			}
+//			continue
+//		}
+//		...
+//	}
+func (a ArgOf[T, U]) Fail(item string, err error) error {
+	e := &ItemError{item, err}
+	if a.env != nil && a.env.errors != nil && a.env.errors.add(e, a.env.maxErrors) {
+		return e
+	}
+	if a.env == nil || a.env.onError == nil {
+		return e
+	}
+	switch action := a.env.onError(e); action.kind {
+	case skipAction:
+		a.Report(e)
+		return nil
+	case replaceAction:
+		a.Report(e)
+		if out, ok := any(a.Out).(chan<- string); ok {
+			out <- action.replace
+		}
+		return nil
+	}
+	return e
+}
+
+// ContinueOnError arranges for every failure to process an item (see
+// Arg.Fail) to be reported (see WithReporter) and skipped instead of
+// aborting the pipeline. E.g., the following prints all readable
+// files under dir and logs problems with other files:
+//
+//	r := stream.NewRunner(
+//		stream.ContinueOnError(),
+//		stream.WithReporter(func(err error) { log.Print(err) }),
+//	)
+//	r.Run(stream.Find(dir), stream.WriteLines(os.Stdout))
+func ContinueOnError() RunOption {
+	return OnError(func(error) Action { return Skip })
+}
@@ -0,0 +1,183 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// FileOpFilter is a Filter that performs a filesystem operation
+// (copy, move, or remove) for every input item.
+type FileOpFilter struct {
+	name      string // Name of the operation, as reported by DryRun
+	dir       string // Destination directory, if any
+	op        func(src, dst string) error
+	dryRun    io.Writer
+	keepGoing bool
+	pairs     bool // Items are "src dst" pairs
+}
+
+// CopyTo returns a filter that copies files into directory dir. Each
+// input item is a path src, which is copied to dir/base(src) (see
+// Pairs for choosing another name). The filter yields the destination
+// path of every copied file. File permissions are preserved, but
+// directories are not copied. Copying a file onto itself fails.
+func CopyTo(dir string) *FileOpFilter {
+	return &FileOpFilter{name: "cp", dir: dir, op: copyFile}
+}
+
+// MoveTo returns a filter that moves files into directory dir. Input
+// items are interpreted as in CopyTo. The filter yields the
+// destination path of every moved file. Files that cannot be renamed
+// because dir is on a different device are copied and then removed.
+func MoveTo(dir string) *FileOpFilter {
+	return &FileOpFilter{name: "mv", dir: dir, op: moveFile}
+}
+
+// Remove returns a filter that removes every input path and yields
+// it. Non-empty directories are not removed.
+func Remove() *FileOpFilter {
+	return &FileOpFilter{
+		name: "rm",
+		op:   func(src, _ string) error { return os.Remove(src) },
+	}
+}
+
+// DryRun adjusts f so that instead of performing any operation, it
+// prints a shell-like description of the operation (e.g., "cp a
+// dir/a") followed by a newline to w. The filter still yields the
+// paths it would have yielded otherwise.
+func (f *FileOpFilter) DryRun(w io.Writer) *FileOpFilter {
+	f.dryRun = w
+	return f
+}
+
+// KeepGoing adjusts f so that a failed operation does not stop the
+// filter. The failed item is passed to Arg.Fail, so the error policy
+// of the pipeline (see OnError) applies; if the policy aborts, the
+// first such error is returned once all input has been processed
+// instead of right away.
+func (f *FileOpFilter) KeepGoing() *FileOpFilter {
+	f.keepGoing = true
+	return f
+}
+
+// Pairs adjusts f so that every input item may be a pair "src dst" of
+// paths, in which case src is copied or moved to dst instead of
+// dir/base(src). A relative dst is interpreted relative to dir; an
+// absolute dst is used as is. The paths are separated by a tab if
+// the item contains one, which allows paths that contain spaces
+// (e.g., "my file.txt\tbackup/my file.txt"), or else by white space.
+// Items that contain no tab and not exactly two words are treated as
+// a single path as usual.
+func (f *FileOpFilter) Pairs() *FileOpFilter {
+	f.pairs = true
+	return f
+}
+
+// RunFilter performs the operation for every input item. It
+// implements the Filter interface.
+func (f *FileOpFilter) RunFilter(arg Arg) error {
+	var first error
+	for s := range arg.In {
+		src, dst := f.paths(s)
+		var err error
+		switch {
+		case f.dryRun != nil && dst == "":
+			_, err = fmt.Fprintln(f.dryRun, f.name, src)
+		case f.dryRun != nil:
+			_, err = fmt.Fprintln(f.dryRun, f.name, src, dst)
+		default:
+			err = f.op(src, dst)
+		}
+		if err != nil {
+			if err := arg.Fail(s, err); err != nil {
+				if !f.keepGoing {
+					return err
+				}
+				if first == nil {
+					first = err
+				}
+			}
+			continue
+		}
+		if dst == "" {
+			arg.Out <- src
+		} else {
+			arg.Out <- dst
+		}
+	}
+	return first
+}
+
+// paths returns the source and destination for item s.  The
+// destination is empty if f has no destination directory.
+func (f *FileOpFilter) paths(s string) (src, dst string) {
+	src = s
+	if f.dir == "" {
+		return src, ""
+	}
+	if f.pairs {
+		if s, d, ok := pair(s); ok {
+			if !filepath.IsAbs(d) {
+				d = filepath.Join(f.dir, d)
+			}
+			return s, d
+		}
+	}
+	return src, filepath.Join(f.dir, filepath.Base(src))
+}
+
+// pair splits s into a source and a destination path as described
+// for Pairs.
+func pair(s string) (src, dst string, ok bool) {
+	if src, dst, ok := strings.Cut(s, "\t"); ok {
+		return src, dst, true
+	}
+	if words := strings.Fields(s); len(words) == 2 {
+		return words[0], words[1], true
+	}
+	return "", "", false
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("stream.CopyTo: %s is a directory", src)
+	}
+	if dinfo, err := os.Stat(dst); err == nil && os.SameFile(info, dinfo) {
+		return fmt.Errorf("stream.CopyTo: %s and %s are the same file", src, dst)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
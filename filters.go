@@ -1,103 +1,332 @@
 package stream
 
-import "fmt"
+import (
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
 
 // Items emits items.
 func Items(items ...string) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for _, s := range items {
-			arg.Out <- s
-		}
-		return nil
-	})
+	return &builtinFilter{
+		name: "Items",
+		items: func(arg Arg) error {
+			for _, s := range items {
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		batches: func(arg batchArg) error {
+			return sendBatches(arg, len(items), func(i int) string { return items[i] })
+		},
+		lazy: func(iter.Seq[string]) iter.Seq[string] {
+			return slices.Values(items)
+		},
+	}
 }
 
 // Repeat emits n copies of s.
 func Repeat(s string, n int) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for i := 0; i < n; i++ {
-			arg.Out <- s
-		}
-		return nil
-	})
-}
-
-// Numbers emits the integers x..y
-func Numbers(x, y int) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for i := x; i <= y; i++ {
-			arg.Out <- fmt.Sprint(i)
-		}
-		return nil
-	})
+	return &builtinFilter{
+		name: "Repeat",
+		items: func(arg Arg) error {
+			for i := 0; i < n; i++ {
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		batches: func(arg batchArg) error {
+			return sendBatches(arg, n, func(int) string { return s })
+		},
+		lazy: func(iter.Seq[string]) iter.Seq[string] {
+			return func(yield func(string) bool) {
+				for i := 0; i < n && yield(s); i++ {
+				}
+			}
+		},
+	}
 }
 
 // Map calls fn(x) for every item x and yields the outputs of the fn calls.
 func Map(fn func(string) string) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for s := range arg.In {
-			arg.Out <- fn(s)
-		}
-		return nil
+	return mapFilter("Map", fn)
+}
+
+// mapFilter returns a filter like Map(fn) that is identified by name
+// in error messages.
+func mapFilter(name string, fn func(string) string) Filter {
+	return &builtinFilter{
+		name: name,
+		items: func(arg Arg) error {
+			for s := range arg.In {
+				arg.Out <- fn(s)
+			}
+			return nil
+		},
+		batches: func(arg batchArg) error {
+			for b := range arg.In {
+				for i, s := range b {
+					b[i] = fn(s)
+				}
+				arg.Out <- b
+			}
+			return nil
+		},
+		lazy: func(in iter.Seq[string]) iter.Seq[string] {
+			return func(yield func(string) bool) {
+				for s := range in {
+					if !yield(fn(s)) {
+						return
+					}
+				}
+			}
+		},
+	}
+}
+
+// ExpandEnv replaces ${var} and $var in every item with the value of
+// the environment variable var (see os.ExpandEnv). References to
+// undefined variables are replaced by the empty string.
+func ExpandEnv() Filter {
+	return mapFilter("ExpandEnv", os.ExpandEnv)
+}
+
+// ExpandMap is like ExpandEnv, but looks up variables in vars instead
+// of the environment.
+func ExpandMap(vars map[string]string) Filter {
+	return mapFilter("ExpandMap", func(s string) string {
+		return os.Expand(s, func(k string) string { return vars[k] })
 	})
 }
 
 // If emits every input x for which fn(x) is true.
 func If(fn func(string) bool) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for s := range arg.In {
-			if fn(s) {
-				arg.Out <- s
+	return ifFilter("If", fn)
+}
+
+// ifFilter returns a filter like If(fn) that is identified by name in
+// error messages.
+func ifFilter(name string, fn func(string) bool) Filter {
+	return &builtinFilter{
+		name: name,
+		items: func(arg Arg) error {
+			for s := range arg.In {
+				if fn(s) {
+					arg.Out <- s
+				}
 			}
-		}
-		return nil
-	})
+			return nil
+		},
+		batches: func(arg batchArg) error {
+			for b := range arg.In {
+				kept := b[:0]
+				for _, s := range b {
+					if fn(s) {
+						kept = append(kept, s)
+					}
+				}
+				if len(kept) > 0 {
+					arg.Out <- kept
+				}
+			}
+			return nil
+		},
+		lazy: func(in iter.Seq[string]) iter.Seq[string] {
+			return func(yield func(string) bool) {
+				for s := range in {
+					if fn(s) && !yield(s) {
+						return
+					}
+				}
+			}
+		},
+	}
+}
+
+// UniqFilter is a Filter that squashes adjacent items that are
+// identical, or that have the same key.
+type UniqFilter struct {
+	key func(string) string // Nil if entire items are compared
 }
 
 // Uniq squashes adjacent identical items in arg.In into a single output.
-func Uniq() Filter {
-	return FilterFunc(func(arg Arg) error {
-		first := true
-		last := ""
-		for s := range arg.In {
-			if first || last != s {
-				arg.Out <- s
-			}
-			last = s
-			first = false
-		}
-		return nil
+// The part of each item that is compared can be adjusted by calling
+// UniqFilter methods.
+func Uniq() *UniqFilter {
+	return &UniqFilter{}
+}
+
+// By adjusts u so that adjacent items for which key returns the same
+// value are squashed into a single output: the first item of every
+// such run.
+func (u *UniqFilter) By(key func(string) string) *UniqFilter {
+	u.key = key
+	return u
+}
+
+// Column adjusts u so that adjacent items that have the same column n
+// (see Columns) are squashed into a single output: the first item of
+// every such run. Column 0 means the entire item.
+func (u *UniqFilter) Column(n int) *UniqFilter {
+	return u.By(func(s string) string {
+		_, c := column(s, n)
+		return c
 	})
 }
 
+// RunFilter squashes adjacent items. It implements the Filter
+// interface.
+func (u *UniqFilter) RunFilter(arg Arg) error {
+	first := true
+	last := ""
+	for s := range arg.In {
+		k := s
+		if u.key != nil {
+			k = u.key(s)
+		}
+		if first || last != k {
+			arg.Out <- s
+		}
+		last = k
+		first = false
+	}
+	return nil
+}
+
+// UniqBy is equivalent to Uniq().By(key).
+func UniqBy(key func(string) string) Filter {
+	return Uniq().By(key)
+}
+
+// UniqByColumn is equivalent to Uniq().Column(n).
+func UniqByColumn(n int) Filter {
+	return Uniq().Column(n)
+}
+
+// UniqWithCountFilter is a Filter that squashes adjacent identical
+// items and counts them.
+type UniqWithCountFilter struct {
+	width  int
+	sep    string
+	after  bool
+	sorted bool
+}
+
 // UniqWithCount squashes adjacent identical items in arg.In into a single
 // output prefixed with the count of identical items followed by a space.
-func UniqWithCount() Filter {
-	return FilterFunc(func(arg Arg) error {
-		current := ""
-		count := 0
-		for s := range arg.In {
-			if s != current {
-				if count > 0 {
-					arg.Out <- fmt.Sprintf("%d %s", count, current)
+// The format and order of the output can be adjusted by calling
+// UniqWithCountFilter methods.
+func UniqWithCount() *UniqWithCountFilter {
+	return &UniqWithCountFilter{sep: " "}
+}
+
+// Width adjusts u so that counts are right-aligned in a field width
+// characters wide (like "uniq -c" with width 7).
+func (u *UniqWithCountFilter) Width(width int) *UniqWithCountFilter {
+	u.width = width
+	return u
+}
+
+// Separator adjusts u so that sep separates the count from the item
+// instead of a space.
+func (u *UniqWithCountFilter) Separator(sep string) *UniqWithCountFilter {
+	u.sep = sep
+	return u
+}
+
+// CountAfter adjusts u so that the count follows the item instead of
+// preceding it.
+func (u *UniqWithCountFilter) CountAfter() *UniqWithCountFilter {
+	u.after = true
+	return u
+}
+
+// SortByCount adjusts u so that its output is sorted by decreasing
+// count. Items with the same count are kept in input order. The
+// output is held in memory until the input is exhausted (see
+// MemoryBudget).
+func (u *UniqWithCountFilter) SortByCount() *UniqWithCountFilter {
+	u.sorted = true
+	return u
+}
+
+// RunFilter counts the input items. It implements the Filter
+// interface.
+func (u *UniqWithCountFilter) RunFilter(arg Arg) error {
+	type entry struct {
+		item  string
+		count int
+	}
+	var entries []entry
+	var reserved int64
+	defer func() { arg.Release(reserved) }()
+	emit := func(item string, count int) error {
+		if !u.sorted {
+			arg.Out <- u.format(item, count)
+			return nil
+		}
+		if err := arg.Reserve(itemSize(item)); err != nil {
+			return err
+		}
+		reserved += itemSize(item)
+		entries = append(entries, entry{item, count})
+		return nil
+	}
+	current := ""
+	count := 0
+	for s := range arg.In {
+		if s != current {
+			if count > 0 {
+				if err := emit(current, count); err != nil {
+					return err
 				}
-				count = 0
-				current = s
 			}
-			count++
+			count = 0
+			current = s
 		}
-		if count > 0 {
-			arg.Out <- fmt.Sprintf("%d %s", count, current)
+		count++
+	}
+	if count > 0 {
+		if err := emit(current, count); err != nil {
+			return err
 		}
-		return nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].count > entries[j].count
 	})
+	for _, e := range entries {
+		arg.Out <- u.format(e.item, e.count)
+	}
+	return nil
+}
+
+// format returns the output for count copies of item.
+func (u *UniqWithCountFilter) format(item string, count int) string {
+	n := fmt.Sprintf("%*d", u.width, count)
+	if u.after {
+		return item + u.sep + n
+	}
+	return n + u.sep + item
 }
 
 // Reverse yields items in the reverse of the order it received them.
 func Reverse() Filter {
 	return FilterFunc(func(arg Arg) error {
 		var data []string
+		var reserved int64
+		defer func() { arg.Release(reserved) }()
 		for s := range arg.In {
+			if err := arg.Reserve(itemSize(s)); err != nil {
+				return err
+			}
+			reserved += itemSize(s)
 			data = append(data, s)
 		}
 		for i := len(data) - 1; i >= 0; i-- {
@@ -107,42 +336,174 @@ func Reverse() Filter {
 	})
 }
 
-// NumberLines prefixes its item with its index in the input sequence
-// (starting at 1) followed by a space.
-func NumberLines() Filter {
+// Cycle yields its input n times in a row. The input is buffered
+// after it is yielded the first time. If n is not positive, the input
+// is yielded repeatedly until the rest of the pipeline wants no more
+// items (see ErrStopped) or until the context of the pipeline (see
+// Arg.Context) is done, in which case the filter returns the
+// context's error.
+func Cycle(n int) Filter {
 	return FilterFunc(func(arg Arg) error {
-		line := 1
+		var data []string
+		var reserved int64
+		defer func() { arg.Release(reserved) }()
 		for s := range arg.In {
-			arg.Out <- fmt.Sprintf("%5d %s", line, s)
-			line++
+			if err := arg.Reserve(itemSize(s)); err != nil {
+				return err
+			}
+			reserved += itemSize(s)
+			data = append(data, s)
+			arg.Out <- s
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		for i := 1; n <= 0 || i < n; i++ {
+			for _, s := range data {
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	})
 }
 
+// NumberLinesFilter is a Filter that numbers its input items.
+type NumberLinesFilter struct {
+	start    int
+	width    int
+	zero     bool
+	sep      string
+	nonBlank bool
+	offsets  bool
+}
+
+// NumberLines prefixes its item with its index in the input sequence
+// (starting at 1) followed by a space. Numbers are right-aligned in a
+// field five characters wide. The numbering and formatting can be
+// adjusted by calling NumberLinesFilter methods.
+func NumberLines() *NumberLinesFilter {
+	return &NumberLinesFilter{start: 1, width: 5, sep: " "}
+}
+
+// Start adjusts n so that the first item is numbered start.
+func (n *NumberLinesFilter) Start(start int) *NumberLinesFilter {
+	n.start = start
+	return n
+}
+
+// Width adjusts n so that numbers are right-aligned in a field width
+// characters wide. Use zero to avoid padding.
+func (n *NumberLinesFilter) Width(width int) *NumberLinesFilter {
+	n.width = width
+	return n
+}
+
+// ZeroPad adjusts n so that numbers are padded with zeros instead of
+// spaces.
+func (n *NumberLinesFilter) ZeroPad() *NumberLinesFilter {
+	n.zero = true
+	return n
+}
+
+// Separator adjusts n so that sep separates the number from the item
+// instead of a space.
+func (n *NumberLinesFilter) Separator(sep string) *NumberLinesFilter {
+	n.sep = sep
+	return n
+}
+
+// NonBlank adjusts n so that only items that are not empty are
+// numbered (like "nl -bt"). Empty items are emitted unchanged and do
+// not consume a number.
+func (n *NumberLinesFilter) NonBlank() *NumberLinesFilter {
+	n.nonBlank = true
+	return n
+}
+
+// ByteOffsets adjusts n so that items are prefixed with the byte
+// offset at which they start instead of their index, assuming that
+// every item is followed by a newline (as written by WriteLines).
+// Offsets start at the value passed to Start minus one, i.e., at
+// zero by default.
+func (n *NumberLinesFilter) ByteOffsets() *NumberLinesFilter {
+	n.offsets = true
+	return n
+}
+
+// RunFilter numbers the input items. It implements the Filter
+// interface.
+func (n *NumberLinesFilter) RunFilter(arg Arg) error {
+	format := fmt.Sprintf("%%%dd%%s%%s", n.width)
+	if n.zero {
+		format = fmt.Sprintf("%%0%dd%%s%%s", n.width)
+	}
+	line := n.start
+	if n.offsets {
+		line--
+	}
+	for s := range arg.In {
+		if n.nonBlank && s == "" {
+			arg.Out <- s
+			continue
+		}
+		arg.Out <- fmt.Sprintf(format, line, n.sep, s)
+		if n.offsets {
+			line += len(s) + 1
+		} else {
+			line++
+		}
+	}
+	return nil
+}
+
+// ColumnsFilter is a Filter that selects columns of its input items.
+type ColumnsFilter struct {
+	columns []int
+	delim   rune
+}
+
 // Columns splits each item into columns and yields the concatenation
 // (separated by spaces) of the columns numbers passed as arguments.
 // Columns are numbered starting at 1.  If a column number is bigger
-// than the number of columns in an item, it is skipped.
-func Columns(columns ...int) Filter {
-	return FilterFunc(func(arg Arg) error {
-		for _, c := range columns {
-			if c <= 0 {
-				return fmt.Errorf("stream.Columns: invalid column number %d", c)
-			}
+// than the number of columns in an item, it is skipped. By default,
+// columns are separated by white space; this can be changed by
+// calling Delimiter.
+func Columns(columns ...int) *ColumnsFilter {
+	return &ColumnsFilter{columns: columns}
+}
+
+// Delimiter adjusts c so that columns are separated by every
+// occurrence of delim (like "cut -d"), and the selected columns are
+// joined by delim instead of a space. E.g., Columns(1,
+// 6).Delimiter(':') yields the user names and home directories from
+// /etc/passwd.
+func (c *ColumnsFilter) Delimiter(delim rune) *ColumnsFilter {
+	c.delim = delim
+	return c
+}
+
+// RunFilter yields the selected columns. It implements the Filter
+// interface.
+func (c *ColumnsFilter) RunFilter(arg Arg) error {
+	for _, col := range c.columns {
+		if col <= 0 {
+			return fmt.Errorf("stream.Columns: invalid column number %d", col)
 		}
-		for s := range arg.In {
-			result := ""
-			for _, col := range columns {
-				if _, c := column(s, col); c != "" {
-					if result != "" {
-						result = result + " "
-					}
-					result = result + c
-				}
+	}
+	sep := " "
+	if c.delim != 0 {
+		sep = string(c.delim)
+	}
+	for s := range arg.In {
+		var parts []string
+		for _, col := range c.columns {
+			if found, v := delimitedColumn(s, col, c.delim); found == 0 && (v != "" || c.delim != 0) {
+				parts = append(parts, v)
 			}
-			arg.Out <- result
 		}
-		return nil
-	})
+		arg.Out <- strings.Join(parts, sep)
+	}
+	return nil
 }
@@ -3,31 +3,45 @@ package stream
 import (
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
-// FindFilter is a filter that produces matching nodes under a filesystem
-// directory.
+// FindFilter is a filter that produces matching nodes under one or more
+// filesystem directories.
 type FindFilter struct {
-	dir       string
+	dirs      []string
 	ifmode    func(os.FileMode) bool
 	skipdirif func(string) bool
+	prune     []*regexp.Regexp
+	path      func(root, n string) (string, error)
+	err       error // Deferred error reported when the filter runs
 }
 
-// Find returns a filter that produces matching nodes under a
-// filesystem directory. The items yielded by the filter will be
-// prefixed by dir. E.g., if dir contains subdir/file, the filter
-// will yield dir/subdir/file. By default, the filter matches all types
-// of files (regular files, directories, symbolic links, etc.).
-// This behavior can be adjusted by calling FindFilter methods
-// before executing the filter.
-func Find(dir string) *FindFilter {
+// Find returns a filter that produces matching nodes under each of
+// the filesystem directories dirs (in order). The items yielded by
+// the filter will be prefixed by the directory they were found
+// under. E.g., if dir contains subdir/file, the filter will yield
+// dir/subdir/file. By default, the filter matches all types of files
+// (regular files, directories, symbolic links, etc.).  This behavior
+// can be adjusted by calling FindFilter methods before executing the
+// filter. A node that cannot be read is handled by the error policy
+// of the pipeline (see OnError): by default, Find fails.
+func Find(dirs ...string) *FindFilter {
 	return &FindFilter{
-		dir:       dir,
+		dirs:      dirs,
 		ifmode:    func(os.FileMode) bool { return true },
 		skipdirif: func(d string) bool { return false },
+		path:      func(root, n string) (string, error) { return n, nil },
 	}
 }
 
+// Also adjusts f so that it additionally walks the directories dirs
+// after the directories it already walks.
+func (f *FindFilter) Also(dirs ...string) *FindFilter {
+	f.dirs = append(f.dirs, dirs...)
+	return f
+}
+
 // IfMode adjusts f so it only matches nodes for which fn(mode) returns true.
 func (f *FindFilter) IfMode(fn func(os.FileMode) bool) *FindFilter {
 	f.ifmode = fn
@@ -41,18 +55,81 @@ func (f *FindFilter) SkipDirIf(fn func(d string) bool) *FindFilter {
 	return f
 }
 
-// RunFilter yields contents of a filesystem tree. It implements the
+// Prune adjusts f so that nodes whose path matches the regular
+// expression r are skipped. If the node is a directory, all of its
+// descendents are skipped as well. The path matched against r is the
+// path that would otherwise have been yielded by f.
+func (f *FindFilter) Prune(r string) *FindFilter {
+	re, err := regexp.Compile(r)
+	if err != nil {
+		f.err = err
+		return f
+	}
+	f.prune = append(f.prune, re)
+	return f
+}
+
+// Absolute adjusts f so that it yields absolute paths regardless of
+// how the directories passed to Find were spelled.
+func (f *FindFilter) Absolute() *FindFilter {
+	f.path = func(root, n string) (string, error) { return filepath.Abs(n) }
+	return f
+}
+
+// Relative adjusts f so that it yields paths relative to the
+// directory they were found under. E.g., if dir contains
+// subdir/file, the filter will yield subdir/file. The directory
+// itself is yielded as ".".
+func (f *FindFilter) Relative() *FindFilter {
+	f.path = filepath.Rel
+	return f
+}
+
+// pruned returns true if the path p matches one of the Prune patterns.
+func (f *FindFilter) pruned(p string) bool {
+	for _, re := range f.prune {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunFilter yields contents of the filesystem trees. It implements the
 // Filter interface.
 func (f *FindFilter) RunFilter(arg Arg) error {
-	return filepath.Walk(f.dir, func(n string, s os.FileInfo, e error) error {
+	if f.err != nil {
+		return f.err
+	}
+	for _, dir := range f.dirs {
+		if err := f.walk(dir, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk yields the matching nodes under dir.
+func (f *FindFilter) walk(dir string, arg Arg) error {
+	return filepath.Walk(dir, func(n string, s os.FileInfo, e error) error {
 		if e != nil {
-			return e
+			return arg.Fail(n, e)
 		}
 		if s.Mode().IsDir() && f.skipdirif(n) {
 			return filepath.SkipDir
 		}
+		p, err := f.path(dir, n)
+		if err != nil {
+			return err
+		}
+		if f.pruned(p) {
+			if s.Mode().IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if f.ifmode(s.Mode()) {
-			arg.Out <- n
+			return arg.Send(p)
 		}
 		return nil
 	})
@@ -1,18 +1,56 @@
 package stream
 
-// First yields the first n items that it receives.
+import "iter"
+
+// First yields the first n items that it receives. Once it has seen
+// n items, the preceding filters are told to stop producing items
+// (see ErrStopped), so First can be used to look at the start of a
+// long or unbounded sequence.
 func First(n int) Filter {
-	return FilterFunc(func(arg Arg) error {
-		seen := 0
-		for s := range arg.In {
-			if seen >= n {
-				break
+	return &builtinFilter{
+		name: "First",
+		items: func(arg Arg) error {
+			if n <= 0 {
+				return nil
 			}
-			arg.Out <- s
-			seen++
-		}
-		return nil
-	})
+			seen := 0
+			for s := range arg.In {
+				arg.Out <- s
+				if seen++; seen >= n {
+					break
+				}
+			}
+			return nil
+		},
+		batches: func(arg batchArg) error {
+			seen := 0
+			for b := range arg.In {
+				if seen >= n {
+					break
+				}
+				b = b[:min(len(b), n-seen)]
+				arg.Out <- b
+				seen += len(b)
+			}
+			return nil
+		},
+		lazy: func(in iter.Seq[string]) iter.Seq[string] {
+			return func(yield func(string) bool) {
+				if n <= 0 {
+					return
+				}
+				seen := 0
+				for s := range in {
+					if !yield(s) {
+						return
+					}
+					if seen++; seen >= n {
+						return
+					}
+				}
+			}
+		},
+	}
 }
 
 // DropFirst yields all items except for the first n items that it receives.
@@ -33,12 +71,17 @@ func DropFirst(n int) Filter {
 type ring struct {
 	buf     []string
 	next, n int
+	size    int64 // Sum of itemSize for all buffered items
 }
 
 func newRing(n int) *ring   { return &ring{buf: make([]string, n)} }
 func (r *ring) empty() bool { return r.n == 0 }
 func (r *ring) full() bool  { return r.n == len(r.buf) }
 func (r *ring) pushBack(s string) {
+	if r.full() {
+		r.size -= itemSize(r.buf[r.next])
+	}
+	r.size += itemSize(s)
 	r.buf[r.next] = s
 	r.next = (r.next + 1) % len(r.buf)
 	if r.n < len(r.buf) {
@@ -51,6 +94,27 @@ func (r *ring) popFront() string {
 	first := (r.next - r.n + len(r.buf)) % len(r.buf)
 	s := r.buf[first]
 	r.n--
+	r.size -= itemSize(s)
+	return s
+}
+
+// push adds s to r, accounting for the change in the size of r in
+// the memory budget of arg.
+func (r *ring) push(arg Arg, s string) error {
+	before := r.size
+	r.pushBack(s)
+	if r.size < before {
+		arg.Release(before - r.size)
+		return nil
+	}
+	return arg.Reserve(r.size - before)
+}
+
+// pop removes and returns the first item in r, returning its memory
+// to the memory budget of arg.
+func (r *ring) pop(arg Arg) string {
+	s := r.popFront()
+	arg.Release(itemSize(s))
 	return s
 }
 
@@ -58,11 +122,14 @@ func (r *ring) popFront() string {
 func Last(n int) Filter {
 	return FilterFunc(func(arg Arg) error {
 		r := newRing(n)
+		defer func() { arg.Release(r.size) }()
 		for s := range arg.In {
-			r.pushBack(s)
+			if err := r.push(arg, s); err != nil {
+				return err
+			}
 		}
 		for !r.empty() {
-			arg.Out <- r.popFront()
+			arg.Out <- r.pop(arg)
 		}
 		return nil
 	})
@@ -72,11 +139,14 @@ func Last(n int) Filter {
 func DropLast(n int) Filter {
 	return FilterFunc(func(arg Arg) error {
 		r := newRing(n)
+		defer func() { arg.Release(r.size) }()
 		for s := range arg.In {
 			if r.full() {
-				arg.Out <- r.popFront()
+				arg.Out <- r.pop(arg)
+			}
+			if err := r.push(arg, s); err != nil {
+				return err
 			}
-			r.pushBack(s)
 		}
 		return nil
 	})
@@ -0,0 +1,48 @@
+package stream
+
+// Scan passes an accumulator and every input item to fn, starting
+// with init as the accumulator, and emits every result of fn, which
+// becomes the accumulator for the next item. E.g., the following
+// emits running totals:
+//
+//	stream.Scan("0", func(total, s string) string {
+//		a, _ := strconv.Atoi(total)
+//		b, _ := strconv.Atoi(s)
+//		return strconv.Itoa(a + b)
+//	})
+func Scan(init string, fn func(acc, item string) string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		acc := init
+		for s := range arg.In {
+			acc = fn(acc, s)
+			arg.Out <- acc
+		}
+		return nil
+	})
+}
+
+// Reduce is like Scan, but only emits the final accumulator (or init
+// if there is no input), so a pipeline can end with a fold without
+// collecting all items first. E.g., the following prints the total
+// size of the files under dir:
+//
+//	stream.Run(
+//		stream.Find(dir).IfMode(os.FileMode.IsRegular),
+//		stream.Stat("%s"),
+//		stream.Reduce("0", func(total, s string) string {
+//			a, _ := strconv.ParseInt(total, 10, 64)
+//			b, _ := strconv.ParseInt(s, 10, 64)
+//			return strconv.FormatInt(a+b, 10)
+//		}),
+//		stream.WriteLines(os.Stdout),
+//	)
+func Reduce(init string, fn func(acc, item string) string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		acc := init
+		for s := range arg.In {
+			acc = fn(acc, s)
+		}
+		arg.Out <- acc
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// observedStage tracks one stage of a pipeline that is executed with
+// instrumentation (see WithWatchdog and WithCollector). The stage
+// writes to out, from which a relay goroutine copies items to the
+// input of the next stage, counting them along the way.
+type observedStage struct {
+	name    string // Name given by Named, if any
+	out     chan string
+	done    atomic.Bool
+	items   atomic.Int64 // Number of items copied by the relay
+	bytes   atomic.Int64 // Number of bytes in items copied by the relay
+	sending atomic.Bool  // Relay is waiting for the next stage to read
+
+	// Sampled durations; only accessed by the monitor goroutine.
+	active, blocked time.Duration
+}
+
+func (s *observedStage) relay(next chan<- string) {
+	for item := range s.out {
+		s.sending.Store(true)
+		next <- item
+		s.sending.Store(false)
+		s.items.Add(1)
+		s.bytes.Add(int64(len(item)))
+	}
+	close(next)
+}
+
+// stageState returns a description of what stage i appears to be
+// doing, and whether it appears to be blocked.
+func stageState(stages []*observedStage, i int) (string, bool) {
+	s := stages[i]
+	switch {
+	case s.done.Load():
+		return "finished", false
+	case len(s.out) == cap(s.out):
+		return "waiting to write output", true
+	case i > 0 && stages[i-1].sending.Load():
+		return "not reading input", false
+	case i > 0 && !stages[i-1].done.Load() && len(stages[i-1].out) == 0:
+		return "waiting for input", true
+	}
+	return "running", false
+}
+
+// sampleInterval is how often the stages of an instrumented pipeline
+// are sampled.
+const sampleInterval = 10 * time.Millisecond
+
+// observe calls fn(s) for every item s in the output of the sequence
+// of filters, while sampling the state of every stage for the
+// watchdog and collector of r.
+func (r *Runner) observe(env *runEnv, filters []Filter, fn func(s string) bool) error {
+	e := &filterErrors{}
+	in := make(chan string)
+	close(in)
+	var inStop *stopSignal
+	stages := make([]*observedStage, len(filters))
+	for i, f := range filters {
+		st := &observedStage{name: filterName(f), out: make(chan string, channelBuffer)}
+		stages[i] = st
+		outStop := newStopSignal()
+		arg := Arg{In: in, Out: st.out, env: env, inStop: inStop, outStop: outStop}
+		go func() {
+			runFilter(f, arg, e)
+			st.done.Store(true)
+		}()
+		next := make(chan string)
+		go st.relay(next)
+		in, inStop = next, outStop
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	clock := Arg{env: env}.Clock()
+	go func() {
+		r.monitor(env.logger, clock, stages, stop)
+		close(stopped)
+	}()
+	for s := range in {
+		if !fn(s) {
+			inStop.raise()
+			break
+		}
+	}
+	for range in { // Discard items produced before the filters stopped
+	}
+	close(stop)
+	<-stopped
+	return e.getError()
+}
+
+// monitor periodically samples stages, reading the time from clock,
+// until stop is closed.
+func (r *Runner) monitor(logger *slog.Logger, clock Clock, stages []*observedStage, stop <-chan struct{}) {
+	ticker := clock.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	last := clock.Now()
+	var stalls *stallDetector
+	if r.watchdog != nil {
+		stalls = newStallDetector(r.watchdog, logger, stages, last)
+	}
+	lastReport := last
+	execution := executions.Add(1)
+	for {
+		select {
+		case <-stop:
+			if r.collector != nil {
+				r.collector.Collect(stageMetrics(stages, execution, true))
+			}
+			return
+		case <-ticker.C():
+		}
+		now := clock.Now()
+		for i, st := range stages {
+			if st.done.Load() {
+				continue
+			}
+			if _, blocked := stageState(stages, i); blocked {
+				st.blocked += now.Sub(last)
+			} else {
+				st.active += now.Sub(last)
+			}
+		}
+		last = now
+		if stalls != nil {
+			stalls.check(now)
+		}
+		if r.collector != nil && now.Sub(lastReport) >= r.collectInterval {
+			lastReport = now
+			r.collector.Collect(stageMetrics(stages, execution, false))
+		}
+	}
+}
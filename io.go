@@ -2,32 +2,131 @@ package stream
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 )
 
+// CatFilter is a Filter that emits the lines of a sequence of files,
+// optionally annotated with where each line came from.
+type CatFilter struct {
+	filenames   []string
+	filename    bool
+	lineNumbers bool
+	offsets     bool
+	decode      bool
+}
+
 // Cat emits each line from each named file in order. If no arguments
-// are specified, Cat copies its input to its output.
-func Cat(filenames ...string) Filter {
-	return FilterFunc(func(arg Arg) error {
-		if len(filenames) == 0 {
-			for s := range arg.In {
-				arg.Out <- s
-			}
-			return nil
+// are specified, Cat copies its input to its output. The emitted
+// lines can be annotated with their origin by calling CatFilter
+// methods. A file that cannot be read is handled by the error policy
+// of the pipeline (see OnError): by default, Cat fails.
+func Cat(filenames ...string) *CatFilter {
+	return &CatFilter{filenames: filenames}
+}
+
+// WithFilename adjusts c so that each line is prefixed by the name of
+// the file it came from followed by a colon. It has no effect if c
+// copies its input.
+func (c *CatFilter) WithFilename() *CatFilter {
+	c.filename = true
+	return c
+}
+
+// WithLineNumbers adjusts c so that each line is prefixed by its line
+// number within its file (starting at 1) followed by a colon. The
+// line number follows the filename if both are requested.
+func (c *CatFilter) WithLineNumbers() *CatFilter {
+	c.lineNumbers = true
+	return c
+}
+
+// WithOffsets adjusts c so that each line is prefixed by the byte
+// offset of the start of the line within its file followed by a
+// colon. The offset follows the filename and line number if those
+// are also requested.
+func (c *CatFilter) WithOffsets() *CatFilter {
+	c.offsets = true
+	return c
+}
+
+// DecodeText adjusts c so that byte order marks are removed from the
+// files and files marked as UTF-16 are decoded (see DecodeText).
+// Offsets (see WithOffsets) then count bytes of the decoded text.
+func (c *CatFilter) DecodeText() *CatFilter {
+	c.decode = true
+	return c
+}
+
+// RunFilter emits the lines of the files. It implements the Filter
+// interface.
+func (c *CatFilter) RunFilter(arg Arg) error {
+	if len(c.filenames) == 0 {
+		line, offset := 1, int64(0)
+		for s := range arg.In {
+			arg.Out <- c.prefix("", line, offset) + s
+			line++
+			offset += int64(len(s)) + 1
 		}
-		for _, f := range filenames {
-			file, err := os.Open(f)
-			if err == nil {
-				err = splitIntoLines(file, arg)
-				file.Close()
-			}
-			if err != nil {
+		return nil
+	}
+	for _, f := range c.filenames {
+		file, err := os.Open(f)
+		if err == nil {
+			err = c.catFile(f, file, arg)
+			file.Close()
+		}
+		if err != nil {
+			if err := arg.Fail(f, err); err != nil {
 				return err
 			}
 		}
-		return nil
+	}
+	return nil
+}
+
+func (c *CatFilter) catFile(name string, rd io.Reader, arg Arg) error {
+	if c.decode {
+		rd = DecodeText(rd)
+	}
+	if !c.filename && !c.lineNumbers && !c.offsets {
+		return splitIntoLines(rd, arg)
+	}
+	scanner := bufio.NewScanner(rd)
+	var start, next int64 // Offsets of current and next line
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			start = next
+			next += int64(advance)
+		}
+		return advance, token, err
 	})
+	for line := 1; scanner.Scan(); line++ {
+		if err := arg.Send(c.prefix(name, line, start) + scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// prefix returns the annotation requested for a line.
+func (c *CatFilter) prefix(name string, line int, offset int64) string {
+	p := ""
+	if c.filename && name != "" {
+		p += name + ":"
+	}
+	if c.lineNumbers {
+		p += strconv.Itoa(line) + ":"
+	}
+	if c.offsets {
+		p += strconv.FormatInt(offset, 10) + ":"
+	}
+	return p
 }
 
 // WriteLines prints each input item s followed by a newline to
@@ -53,10 +152,106 @@ func ReadLines(reader io.Reader) Filter {
 	})
 }
 
+// TailFile emits the last n lines of the named file. Unlike
+// Cat(filename) followed by Last(n), it reads the file backwards from
+// the end and stops as soon as it has found n lines, so it is cheap
+// even for very large files.
+func TailFile(filename string, n int) Filter {
+	return FilterFunc(func(arg Arg) error {
+		if n <= 0 {
+			return nil
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		const blockSize = 64 << 10
+		var blocks [][]byte // Blocks read so far, the last one first
+		newlines := 0       // Number of newlines in blocks
+		pos := info.Size()
+		for pos > 0 && newlines < n {
+			size := min(blockSize, pos)
+			pos -= size
+			block := make([]byte, size)
+			if _, err := file.ReadAt(block, pos); err != nil {
+				return err
+			}
+			if len(blocks) == 0 {
+				block = bytes.TrimSuffix(block, []byte("\n"))
+			}
+			newlines += bytes.Count(block, []byte("\n"))
+			blocks = append(blocks, block)
+		}
+		if info.Size() == 0 {
+			return nil
+		}
+		slices.Reverse(blocks)
+		lines := strings.Split(string(bytes.Join(blocks, nil)), "\n")
+		if len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		for _, s := range lines {
+			if err := arg.Send(strings.TrimSuffix(s, "\r")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteNulTerminated prints each input item s followed by a NUL byte
+// to writer; and in addition it emits s. Unlike WriteLines, the
+// output can be split back into the original items even if they
+// contain newlines (e.g., by "xargs -0").
+func WriteNulTerminated(writer io.Writer) Filter {
+	return FilterFunc(func(arg Arg) error {
+		for s := range arg.In {
+			if _, err := writer.Write(append([]byte(s), 0)); err != nil {
+				return err
+			}
+			arg.Out <- s
+		}
+		return nil
+	})
+}
+
+// ReadNulTerminated emits each NUL-terminated item found in reader,
+// such as the output of "find -print0". The final item need not be
+// terminated.
+func ReadNulTerminated(reader io.Reader) Filter {
+	return FilterFunc(func(arg Arg) error {
+		return splitIntoItems(reader, arg, scanNulTerminated)
+	})
+}
+
 func splitIntoLines(rd io.Reader, arg Arg) error {
+	return splitIntoItems(rd, arg, bufio.ScanLines)
+}
+
+func splitIntoItems(rd io.Reader, arg Arg, split bufio.SplitFunc) error {
 	scanner := bufio.NewScanner(rd)
+	scanner.Split(split)
 	for scanner.Scan() {
-		arg.Out <- scanner.Text()
+		if err := arg.Send(scanner.Text()); err != nil {
+			return err
+		}
 	}
 	return scanner.Err()
 }
+
+// scanNulTerminated is a bufio.SplitFunc that returns NUL-terminated
+// items.
+func scanNulTerminated(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,132 @@
+package stream
+
+import "strings"
+
+// JoinFilter is a Filter that joins its input with the output of
+// another filter on a key column.
+type JoinFilter struct {
+	other       Filter
+	col, oth    int
+	left, outer bool
+}
+
+// Join returns a filter that joins every input item with every output
+// item of other that has the same first column (see Columns), like
+// "join". For every matching pair, it yields the input item followed
+// by a space and the columns of the other item except the key column
+// (separated by single spaces). Input items without a match are
+// dropped. other is executed to completion, and its output is held in
+// memory (see MemoryBudget), before any input is read; unlike "join",
+// neither sequence needs to be sorted. Use Cat to join with the lines
+// of a file. The columns and the handling of items without a match
+// can be adjusted by calling JoinFilter methods. E.g.,
+//
+//	stream.Join(stream.Cat("owners.txt")).On(2)
+func Join(other Filter) *JoinFilter {
+	return &JoinFilter{other: other, col: 1, oth: 1}
+}
+
+// On adjusts j so that items are joined on column n of both the input
+// items and the items of the other filter.
+func (j *JoinFilter) On(n int) *JoinFilter {
+	j.col, j.oth = n, n
+	return j
+}
+
+// OnColumns adjusts j so that column n of the input items is matched
+// with column m of the items of the other filter.
+func (j *JoinFilter) OnColumns(n, m int) *JoinFilter {
+	j.col, j.oth = n, m
+	return j
+}
+
+// Left adjusts j so that input items without a match are yielded
+// unchanged instead of being dropped (a left outer join).
+func (j *JoinFilter) Left() *JoinFilter {
+	j.left = true
+	return j
+}
+
+// Outer adjusts j so that, in addition to the input items without a
+// match, the items of the other filter that did not match any input
+// item are yielded unchanged after all other items (a full outer
+// join).
+func (j *JoinFilter) Outer() *JoinFilter {
+	j.left, j.outer = true, true
+	return j
+}
+
+// RunFilter joins the items. It implements the Filter interface.
+func (j *JoinFilter) RunFilter(arg Arg) error {
+	type entry struct {
+		item    string
+		rest    string // Columns other than the key column
+		matched bool
+	}
+	var entries []*entry
+	byKey := map[string][]*entry{}
+	var reserved int64
+	defer func() { arg.Release(reserved) }()
+	var rerr error
+	err := forEach(arg.env, j.other, func(s string) {
+		if rerr != nil {
+			return
+		}
+		if rerr = arg.Reserve(2 * itemSize(s)); rerr != nil {
+			return
+		}
+		reserved += 2 * itemSize(s)
+		key, rest, ok := joinKey(s, j.oth)
+		e := &entry{item: s, rest: rest}
+		entries = append(entries, e)
+		if ok {
+			byKey[key] = append(byKey[key], e)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if rerr != nil {
+		return rerr
+	}
+	for s := range arg.In {
+		found, key := column(s, j.col)
+		matches := byKey[key]
+		if found < 0 {
+			matches = nil
+		}
+		for _, e := range matches {
+			e.matched = true
+			if e.rest == "" {
+				arg.Out <- s
+			} else {
+				arg.Out <- s + " " + e.rest
+			}
+		}
+		if len(matches) == 0 && j.left {
+			arg.Out <- s
+		}
+	}
+	if j.outer {
+		for _, e := range entries {
+			if !e.matched {
+				arg.Out <- e.item
+			}
+		}
+	}
+	return nil
+}
+
+// joinKey returns column n of s (see Columns) and the other columns of
+// s separated by single spaces. ok is false if s has no column n.
+func joinKey(s string, n int) (key, rest string, ok bool) {
+	if n == 0 {
+		return s, "", true
+	}
+	fields := strings.Fields(s)
+	if n < 1 || n > len(fields) {
+		return "", "", false
+	}
+	rest = strings.Join(append(fields[:n-1:n-1], fields[n:]...), " ")
+	return fields[n-1], rest, true
+}
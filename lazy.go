@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"iter"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// WithLazyExecution arranges for pipelines to be evaluated lazily:
+// items are pulled through the top-level stages of a pipeline as they
+// are consumed, instead of being pushed through channels by one
+// goroutine per stage. This makes short pipelines, e.g., First(1)
+// applied to a large source, much cheaper. Some built-in filters
+// (Items, ItemsFromSlice, ItemsFromSeq, Repeat, Map, If, Grep, GrepNot,
+// and First) run lazily; every other filter still runs in its own
+// goroutine. The start and finish of lazy stages are not logged.
+// Lazy execution takes precedence over batching (see WithBatchSize),
+// and is not used by pipelines that are instrumented by WithWatchdog
+// or WithCollector.
+func WithLazyExecution() RunOption {
+	return func(r *Runner) { r.env.lazy = true }
+}
+
+// forEachLazy is like forEachWhile, but evaluates the top-level
+// stages filters lazily where possible.
+func forEachLazy(env *runEnv, filters []Filter, fn func(s string) bool) error {
+	e := &filterErrors{}
+	failed := &atomic.Bool{} // Set once a lazy stage has panicked
+	seq := func(func(string) bool) {}
+	for i, f := range filters {
+		if b, ok := lazyFilter(f); ok {
+			seq = lazyStage(i, f, b.lazy(seq), e, failed)
+		} else {
+			seq = goroutineStage(env, f, seq, e)
+		}
+	}
+	done := env.ctx.Done()
+	for s := range seq {
+		select {
+		case <-done:
+			e.record(env.ctx.Err())
+			return e.getError()
+		default:
+		}
+		if !fn(s) {
+			break
+		}
+	}
+	return e.getError()
+}
+
+// lazyFilter returns the filter run by the top-level stage f if it can
+// run lazily.
+func lazyFilter(f Filter) (*builtinFilter, bool) {
+	if t, ok := f.(*topStage); ok {
+		f = t.f
+	}
+	b, ok := f.(*builtinFilter)
+	return b, ok && b.lazy != nil
+}
+
+// lazyStage returns the output of the top-level stage f, numbered i,
+// whose lazy evaluation is seq. A panic in the stage is recorded in e
+// and stops the pipeline.
+func lazyStage(i int, f Filter, seq iter.Seq[string], e *filterErrors, failed *atomic.Bool) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		downstream := false // Set while items are handed to yield
+		defer func() {
+			if downstream {
+				return // The panic, if any, belongs to a later stage
+			}
+			if v := recover(); v != nil {
+				name := stageName(f)
+				e.record(&StageError{Stage: i + 1, Name: name, Err: &PanicError{Filter: name, Value: v, Stack: debug.Stack()}})
+				failed.Store(true)
+			}
+		}()
+		seq(func(s string) bool {
+			if failed.Load() {
+				return false
+			}
+			downstream = true
+			ok := yield(s)
+			downstream = false
+			return ok && !failed.Load()
+		})
+	}
+}
+
+// goroutineStage returns the output of the top-level stage f, which
+// cannot run lazily and therefore runs in its own goroutine with the
+// items of in as its input.
+func goroutineStage(env *runEnv, f Filter, in iter.Seq[string], e *filterErrors) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		input := make(chan string, channelBuffer)
+		output := make(chan string, channelBuffer)
+		inStop, outStop := newStopSignal(), newStopSignal()
+		go func() {
+			defer close(input)
+			for s := range in {
+				select {
+				case input <- s:
+				case <-inStop.done():
+					return
+				}
+			}
+		}()
+		go runFilter(f, Arg{In: input, Out: output, env: env, inStop: inStop, outStop: outStop}, e)
+		defer func() {
+			outStop.raise()
+			for range output { // Wait for the filter to finish
+			}
+		}()
+		for s := range output {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+}
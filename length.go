@@ -0,0 +1,50 @@
+package stream
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// LengthFilter is a Filter that selects items by their length.
+type LengthFilter struct {
+	min, max int
+	bytes    bool
+}
+
+// MinLen emits every item that is at least n characters long.
+func MinLen(n int) *LengthFilter {
+	return LengthBetween(n, math.MaxInt)
+}
+
+// MaxLen emits every item that is at most n characters long.
+func MaxLen(n int) *LengthFilter {
+	return LengthBetween(0, n)
+}
+
+// LengthBetween emits every item that is at least a and at most b
+// characters long.
+func LengthBetween(a, b int) *LengthFilter {
+	return &LengthFilter{min: a, max: b}
+}
+
+// Bytes adjusts l so that lengths are measured in bytes instead of
+// characters (runes).
+func (l *LengthFilter) Bytes() *LengthFilter {
+	l.bytes = true
+	return l
+}
+
+// RunFilter emits the selected items. It implements the Filter
+// interface.
+func (l *LengthFilter) RunFilter(arg Arg) error {
+	for s := range arg.In {
+		n := len(s)
+		if !l.bytes {
+			n = utf8.RuneCountInString(s)
+		}
+		if n >= l.min && n <= l.max {
+			arg.Out <- s
+		}
+	}
+	return nil
+}
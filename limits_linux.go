@@ -0,0 +1,22 @@
+package stream
+
+import "syscall"
+
+// argMax returns the maximum number of bytes in the arguments and
+// environment passed to a new process. Linux allows a quarter of the
+// stack size limit, but no less than 128KiB.
+func argMax() int {
+	const min = 128 << 10
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_STACK, &rlim); err != nil {
+		return min
+	}
+	n := rlim.Cur / 4
+	if n < min {
+		return min
+	}
+	if n > 1<<30 { // Also guards against RLIM_INFINITY
+		n = 1 << 30
+	}
+	return int(n)
+}
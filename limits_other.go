@@ -0,0 +1,17 @@
+//go:build !linux
+
+package stream
+
+import "runtime"
+
+// argMax returns the maximum number of bytes in the arguments and
+// environment passed to a new process.
+func argMax() int {
+	switch runtime.GOOS {
+	case "windows":
+		return 32 << 10
+	case "darwin", "ios":
+		return 1 << 20
+	}
+	return 256 << 10
+}
@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrMemoryBudget is returned (wrapped) by a filter that needed more
+// memory than allowed by the memory budget of the pipeline (see
+// MemoryBudget).
+var ErrMemoryBudget = errors.New("stream: memory budget exceeded")
+
+// MemoryBudget limits the memory that filters which buffer items (like
+// Sort, Reverse, and Last) may use for buffered items to a total of n
+// bytes across the whole pipeline. A filter that would exceed the
+// budget fails with an error that wraps ErrMemoryBudget. Items in
+// flight between filters are not counted; there are at most a few
+// thousand of those per filter.
+func MemoryBudget(n int64) RunOption {
+	return func(r *Runner) { r.env.budget = n }
+}
+
+// memoryBudget tracks the memory reserved by the filters of a
+// pipeline.
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+}
+
+// itemOverhead approximates the memory used by a buffered item in
+// addition to its contents.
+const itemOverhead = 16
+
+// itemSize returns the memory needed to buffer s.
+func itemSize(s string) int64 { return int64(len(s)) + itemOverhead }
+
+// Reserve is called by a filter before buffering n bytes of data. It
+// returns an error that wraps ErrMemoryBudget if the memory budget of
+// the pipeline (see MemoryBudget) would be exceeded; the filter should
+// then return the error. Memory that is no longer needed should be
+// returned to the budget with Release.
+func (a ArgOf[T, U]) Reserve(n int64) error {
+	if a.env == nil || a.env.memory == nil {
+		return nil
+	}
+	m := a.env.memory
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.used+n > m.limit {
+		return fmt.Errorf("%w: %d bytes in use, %d more requested, limit is %d",
+			ErrMemoryBudget, m.used, n, m.limit)
+	}
+	m.used += n
+	return nil
+}
+
+// Release returns n bytes previously obtained with Reserve to the
+// memory budget of the pipeline.
+func (a ArgOf[T, U]) Release(n int64) {
+	if a.env == nil || a.env.memory == nil {
+		return
+	}
+	m := a.env.memory
+	m.mu.Lock()
+	m.used -= n
+	m.mu.Unlock()
+}
@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StageMetrics holds statistics about one stage of a pipeline.
+type StageMetrics struct {
+	Index    int    // Position of the stage in the pipeline, starting at 0
+	Name     string // Name given to the stage by Named, if any
+	ItemsIn  int64  // Items read by the stage
+	ItemsOut int64  // Items written by the stage
+	BytesIn  int64  // Bytes in items read by the stage
+	BytesOut int64  // Bytes in items written by the stage
+	Done     bool   // The stage has finished
+
+	// Execution identifies the execution of the pipeline, so that a
+	// Collector that receives metrics from several pipelines (or
+	// several executions of one pipeline) can tell them apart. Final
+	// is set in the last report for the execution.
+	Execution uint64
+	Final     bool
+
+	// Active and Blocked estimate how long the stage has spent doing
+	// work and how long it has spent waiting for input or waiting for
+	// the next stage to accept its output. They are measured by
+	// periodic sampling.
+	Active  time.Duration
+	Blocked time.Duration
+}
+
+// Collector receives metrics from pipelines executed by a Runner
+// configured with WithCollector.
+type Collector interface {
+	// Collect is called with the metrics for every stage of a
+	// pipeline, in pipeline order. It is called periodically while
+	// the pipeline runs, and once more when the last stage finishes.
+	// Earlier stages may still be discarding unread input at that
+	// point (e.g., if the last stage is First).
+	Collect(stages []StageMetrics)
+}
+
+// WithCollector arranges for c to receive metrics about every
+// pipeline executed by the Runner, every interval while the pipeline
+// runs. As with WithWatchdog, only top-level filters are observed, and
+// observed pipelines run somewhat slower.
+func WithCollector(c Collector, interval time.Duration) RunOption {
+	return func(r *Runner) {
+		r.collector = c
+		r.collectInterval = interval
+	}
+}
+
+// executions numbers the executions of pipelines for StageMetrics.
+var executions atomic.Uint64
+
+// stageMetrics returns the current metrics for stages, which belong
+// to execution. final is true for the last report.
+func stageMetrics(stages []*observedStage, execution uint64, final bool) []StageMetrics {
+	result := make([]StageMetrics, len(stages))
+	for i, st := range stages {
+		m := StageMetrics{
+			Index:     i,
+			Name:      st.name,
+			ItemsOut:  st.items.Load(),
+			BytesOut:  st.bytes.Load(),
+			Done:      st.done.Load(),
+			Execution: execution,
+			Final:     final,
+			Active:    st.active,
+			Blocked:   st.blocked,
+		}
+		if i > 0 {
+			m.ItemsIn = result[i-1].ItemsOut
+			m.BytesIn = result[i-1].BytesOut
+		}
+		result[i] = m
+	}
+	return result
+}
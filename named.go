@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Named returns a filter that behaves like f, but is identified by
+// name in diagnostics: errors returned by f are prefixed with name
+// (or, if f is a top-level stage, identified by a *StageError),
+// log records written via Arg.Logger carry a "stage" attribute, and
+// the metrics and stall reports produced for top-level stages (see
+// WithCollector and WithWatchdog) include name. E.g.,
+//
+//	stream.Named("hash-files", stream.Parallel(8, hasher))
+func Named(name string, f Filter) Filter {
+	return &namedFilter{name: name, f: f}
+}
+
+type namedFilter struct {
+	name string
+	f    Filter
+}
+
+func (n *namedFilter) RunFilter(arg Arg) error {
+	if err := n.run(arg); err != nil {
+		return fmt.Errorf("%s: %w", n.name, err)
+	}
+	return nil
+}
+
+// run runs n.f without prefixing its errors.
+func (n *namedFilter) run(arg Arg) error {
+	if arg.env != nil {
+		env := *arg.env
+		env.logger = arg.Logger().With("stage", n.name)
+		arg.env = &env
+	}
+	return n.f.RunFilter(arg)
+}
+
+// filterName returns the name given to f by Named, or "" if f is
+// not named.
+func filterName(f Filter) string {
+	switch f := f.(type) {
+	case *namedFilter:
+		return f.name
+	case *topStage:
+		return filterName(f.f)
+	}
+	return ""
+}
+
+// stageName returns the name to use for filter f in error messages:
+// the name given to f by Named, or else the name of the function that
+// created f (e.g., "Grep"), or the type of f (e.g., "Find" for a
+// *FindFilter).
+func stageName(f any) string {
+	switch f := f.(type) {
+	case *namedFilter:
+		return f.name
+	case *topStage:
+		return stageName(f.f)
+	case *sequence[string]:
+		return "Sequence"
+	case *builtinFilter:
+		return f.name
+	}
+	v := reflect.ValueOf(f)
+	if v.Kind() == reflect.Func {
+		if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+			return funcName(fn.Name())
+		}
+	}
+	t := reflect.TypeOf(f)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		return fmt.Sprintf("%T", f)
+	}
+	name, _, _ := strings.Cut(t.Name(), "[")
+	if t.PkgPath() == reflect.TypeFor[namedFilter]().PkgPath() {
+		return strings.TrimSuffix(name, "Filter")
+	}
+	return path.Base(t.PkgPath()) + "." + name
+}
+
+// funcName converts the name of the function that implements a
+// filter, e.g., "github.com/ghemawat/stream.Grep.func1", into the
+// name of the function that created the filter, e.g., "Grep". Names
+// outside this package keep their package name.
+func funcName(full string) string {
+	name := full[strings.LastIndex(full, "/")+1:]
+	for {
+		i := strings.LastIndex(name, ".")
+		if i < 0 || !strings.HasPrefix(name[i+1:], "func") {
+			break
+		}
+		name = name[:i]
+	}
+	name = strings.ReplaceAll(name, "[...]", "")
+	if pkg := reflect.TypeFor[namedFilter]().PkgPath(); strings.HasPrefix(full, pkg+".") {
+		name = strings.TrimPrefix(name, path.Base(pkg)+".")
+	}
+	return name
+}
@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// NumbersFilter is a Filter that emits a range of integers.
+type NumbersFilter struct {
+	x, y, step *big.Int
+	width      int
+	pad        string
+}
+
+// Numbers emits the integers x..y. The step between numbers and their
+// formatting can be adjusted by calling NumbersFilter methods.
+func Numbers(x, y int) *NumbersFilter {
+	return BigNumbers(big.NewInt(int64(x)), big.NewInt(int64(y)))
+}
+
+// BigNumbers is like Numbers, but accepts arbitrarily large bounds.
+func BigNumbers(x, y *big.Int) *NumbersFilter {
+	return &NumbersFilter{
+		x:    new(big.Int).Set(x),
+		y:    new(big.Int).Set(y),
+		step: big.NewInt(1),
+	}
+}
+
+// Step adjusts n so that consecutive numbers differ by step. If step
+// is negative, numbers are emitted in decreasing order, from x down to
+// y. E.g., Numbers(10, 1).Step(-3) emits 10, 7, 4, 1. The last number
+// emitted is the last one that does not go past y.
+func (n *NumbersFilter) Step(step int) *NumbersFilter {
+	n.step = big.NewInt(int64(step))
+	return n
+}
+
+// Width adjusts n so that numbers are padded with leading spaces to
+// be at least width characters wide.
+func (n *NumbersFilter) Width(width int) *NumbersFilter {
+	n.width, n.pad = width, " "
+	return n
+}
+
+// ZeroPad adjusts n so that numbers are padded with leading zeros to
+// be at least width characters wide (following any minus sign).
+func (n *NumbersFilter) ZeroPad(width int) *NumbersFilter {
+	n.width, n.pad = width, "0"
+	return n
+}
+
+// RunFilter emits the numbers. It implements the Filter interface.
+func (n *NumbersFilter) RunFilter(arg Arg) error {
+	dir := n.step.Sign()
+	if dir == 0 {
+		return fmt.Errorf("stream.Numbers: zero step")
+	}
+	if n.x.IsInt64() && n.y.IsInt64() && n.step.IsInt64() {
+		x, y, step := n.x.Int64(), n.y.Int64(), n.step.Int64()
+		for i := x; (dir > 0 && i <= y) || (dir < 0 && i >= y); i += step {
+			if err := arg.Send(n.format(fmt.Sprint(i))); err != nil {
+				return err
+			}
+			if (dir > 0 && i > math.MaxInt64-step) || (dir < 0 && i < math.MinInt64-step) {
+				break // Next value would overflow
+			}
+		}
+		return nil
+	}
+	for i := new(big.Int).Set(n.x); i.Cmp(n.y)*dir <= 0; i.Add(i, n.step) {
+		if err := arg.Send(n.format(i.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decimalPlaces returns the number of digits after the decimal point
+// in the shortest decimal representation of x.
+func decimalPlaces(x float64) int {
+	s := strconv.FormatFloat(x, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// format pads s as requested.
+func (n *NumbersFilter) format(s string) string {
+	if len(s) >= n.width {
+		return s
+	}
+	padding := strings.Repeat(n.pad, n.width-len(s))
+	if n.pad == "0" && s[0] == '-' {
+		return "-" + padding + s[1:]
+	}
+	return padding + s
+}
+
+// FloatsFilter is a Filter that emits a range of floating point
+// numbers.
+type FloatsFilter struct {
+	x, y, step float64
+	prec       int
+	width      int
+}
+
+// Floats emits the numbers x, x+step, x+2*step, ... up to y (or down
+// to y if step is negative). Since most decimal fractions cannot be
+// represented exactly, each number is rounded to as many decimals as
+// x and step have, so that, e.g., Floats(0, 1, 0.1) emits 0.3 rather
+// than 0.30000000000000004. By default, numbers are then formatted
+// with the smallest number of digits necessary to represent them.
+func Floats(x, y, step float64) *FloatsFilter {
+	return &FloatsFilter{x: x, y: y, step: step, prec: -1}
+}
+
+// Precision adjusts f so that numbers are formatted with prec digits
+// after the decimal point.
+func (f *FloatsFilter) Precision(prec int) *FloatsFilter {
+	f.prec = prec
+	return f
+}
+
+// Width adjusts f so that numbers are padded with leading spaces to
+// be at least width characters wide.
+func (f *FloatsFilter) Width(width int) *FloatsFilter {
+	f.width = width
+	return f
+}
+
+// RunFilter emits the numbers. It implements the Filter interface.
+func (f *FloatsFilter) RunFilter(arg Arg) error {
+	if f.step == 0 || math.IsNaN(f.step) || math.IsInf(f.step, 0) {
+		return fmt.Errorf("stream.Floats: bad step %v", f.step)
+	}
+	if math.IsNaN(f.x) || math.IsInf(f.x, 0) || math.IsNaN(f.y) {
+		return fmt.Errorf("stream.Floats: bad range %v to %v", f.x, f.y)
+	}
+	// Allow for rounding errors in the last value.
+	limit := f.y + f.step*1e-9
+	decimals := max(decimalPlaces(f.x), decimalPlaces(f.step))
+	for i := 0; ; i++ {
+		v := f.x + float64(i)*f.step
+		if (f.step > 0 && v > limit) || (f.step < 0 && v < limit) {
+			return nil
+		}
+		v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'f', decimals, 64), 64)
+		if v == 0 {
+			v = 0 // Avoid printing -0
+		}
+		s := fmt.Sprintf("%*.*f", f.width, f.prec, v)
+		if f.prec < 0 {
+			s = fmt.Sprintf("%*s", f.width, fmt.Sprint(v))
+		}
+		if err := arg.Send(s); err != nil {
+			return err
+		}
+	}
+}
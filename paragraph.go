@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Paragraphs joins every run of non-blank input items into a single
+// item, with the original items separated by newlines. Blank items
+// (those that contain only white space) separate the runs and are
+// dropped. This allows multi-line records, e.g., stanzas of a
+// configuration file, to be processed as units:
+//
+//	stream.Run(
+//		stream.Cat("/etc/hosts.allow"),
+//		stream.Paragraphs(),
+//		stream.Grep(`(?m)^ALL:`),
+//		stream.SplitParagraphs(),
+//		stream.WriteLines(os.Stdout),
+//	)
+func Paragraphs() Filter {
+	return FilterFunc(func(arg Arg) error {
+		var lines []string
+		flush := func() {
+			if len(lines) > 0 {
+				arg.Out <- strings.Join(lines, "\n")
+				lines = lines[:0]
+			}
+		}
+		for s := range arg.In {
+			if strings.TrimSpace(s) == "" {
+				flush()
+			} else {
+				lines = append(lines, s)
+			}
+		}
+		flush()
+		return nil
+	})
+}
+
+// SplitParagraphs reverses Paragraphs: it splits every input item at
+// newlines and emits the resulting lines, with an empty item between
+// the lines of consecutive input items.
+func SplitParagraphs() Filter {
+	return FilterFunc(func(arg Arg) error {
+		first := true
+		for s := range arg.In {
+			if !first {
+				arg.Out <- ""
+			}
+			first = false
+			for _, line := range strings.Split(s, "\n") {
+				arg.Out <- line
+			}
+		}
+		return nil
+	})
+}
+
+// Chunk joins every n consecutive input items into a single item,
+// with the original items separated by sep. If the number of input
+// items is not a multiple of n, the last output item joins the
+// remaining items. This is handy for handing batches of items to a
+// command, e.g.,
+//
+//	stream.Run(
+//		stream.Cat("urls"),
+//		stream.Chunk(100, " "),
+//		stream.Map(func(s string) string { return "wget -q " + s }),
+//		stream.Command("sh"),
+//	)
+func Chunk(n int, sep string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		if n <= 0 {
+			return fmt.Errorf("stream.Chunk: invalid chunk size %d", n)
+		}
+		chunk := make([]string, 0, n)
+		for s := range arg.In {
+			chunk = append(chunk, s)
+			if len(chunk) == n {
+				arg.Out <- strings.Join(chunk, sep)
+				chunk = chunk[:0]
+			}
+		}
+		if len(chunk) > 0 {
+			arg.Out <- strings.Join(chunk, sep)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,353 @@
+package stream
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Parse returns a filter built from a shell-like description of a
+// pipeline. Stages are separated by "|", and each stage consists of
+// the name of a filter followed by its arguments. Arguments are
+// separated by white space and may be quoted as in a POSIX shell
+// (using single quotes, double quotes, or backslashes). E.g.,
+//
+//	f, err := stream.Parse(`find . | grep '\.go$' | sort -n 2 | first 10`)
+//
+// The following filters are built in; others can be added with
+// RegisterFilter.
+//
+//	cat file...          Cat(file...)
+//	columns n...         Columns(n...)
+//	comm [-123] file     Comm(Cat(file)), without the columns suppressed
+//	                     by the flags as in the comm command
+//	droplast n           DropLast(n)
+//	dropfirst n          DropFirst(n)
+//	find [dir...]        Find(dir...), or Find(".") without arguments
+//	first n              First(n)
+//	grep [-v] regexp     Grep(regexp) or GrepNot(regexp)
+//	items item...        Items(item...)
+//	last n               Last(n)
+//	nl                   NumberLines()
+//	numbers x y          Numbers(x, y)
+//	reverse              Reverse()
+//	sample n             Sample(n)
+//	sh script            Shell(script)
+//	sort [-u] [key...]   Sort() with keys "-t n" (Text), "-n n" (Num),
+//	                     "-tr n" (TextDecreasing), "-nr n" (NumDecreasing),
+//	                     "-h n" (HumanSize), "-hr n" (HumanSizeDecreasing),
+//	                     "-V n" (Version), "-Vr n" (VersionDecreasing),
+//	                     "-M n" (Month), made Unique by "-u"
+//	uniq [-c | -k n]     Uniq(), UniqWithCount(), or Uniq().Column(n)
+//	xargs command arg... Xargs(command, arg...)
+func Parse(pipeline string) (Filter, error) {
+	stages, err := splitPipeline(pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("stream.Parse: %v", err)
+	}
+	filters := make([]Filter, len(stages))
+	for i, words := range stages {
+		if len(words) == 0 {
+			return nil, fmt.Errorf("stream.Parse: stage %d is empty", i+1)
+		}
+		fn, ok := lookupFilter(words[0])
+		if !ok {
+			return nil, fmt.Errorf("stream.Parse: stage %d: unknown filter %q", i+1, words[0])
+		}
+		f, err := fn(words[1:])
+		if err != nil {
+			return nil, fmt.Errorf("stream.Parse: stage %d: %s: %v", i+1, words[0], err)
+		}
+		filters[i] = f
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return Sequence(filters...), nil
+}
+
+// FilterMaker builds a filter from the arguments that follow its name
+// in a pipeline description (see Parse).
+type FilterMaker func(args []string) (Filter, error)
+
+var (
+	filterMakersMu sync.RWMutex
+	filterMakers   = map[string]FilterMaker{}
+)
+
+// RegisterFilter makes the filters built by fn available under name
+// to Parse. A previous registration for name, including a built-in
+// one, is replaced.
+func RegisterFilter(name string, fn FilterMaker) {
+	filterMakersMu.Lock()
+	defer filterMakersMu.Unlock()
+	filterMakers[name] = fn
+}
+
+// RegisteredFilters returns the sorted names of all filters known to
+// Parse.
+func RegisteredFilters() []string {
+	filterMakersMu.RLock()
+	defer filterMakersMu.RUnlock()
+	var names []string
+	for name := range filterMakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupFilter(name string) (FilterMaker, bool) {
+	filterMakersMu.RLock()
+	defer filterMakersMu.RUnlock()
+	fn, ok := filterMakers[name]
+	return fn, ok
+}
+
+func init() {
+	RegisterFilter("cat", func(args []string) (Filter, error) {
+		return Cat(args...), nil
+	})
+	RegisterFilter("columns", func(args []string) (Filter, error) {
+		cols, err := intArgs(args, -1)
+		if err != nil {
+			return nil, err
+		}
+		return Columns(cols...), nil
+	})
+	RegisterFilter("comm", parseComm)
+	RegisterFilter("dropfirst", intFilter(DropFirst))
+	RegisterFilter("droplast", intFilter(DropLast))
+	RegisterFilter("find", func(args []string) (Filter, error) {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		return Find(args...), nil
+	})
+	RegisterFilter("first", intFilter(First))
+	RegisterFilter("grep", func(args []string) (Filter, error) {
+		invert := len(args) > 0 && args[0] == "-v"
+		if invert {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want [-v] regexp")
+		}
+		if _, err := regexp.Compile(args[0]); err != nil {
+			return nil, err
+		}
+		if invert {
+			return GrepNot(args[0]), nil
+		}
+		return Grep(args[0]), nil
+	})
+	RegisterFilter("items", func(args []string) (Filter, error) {
+		return Items(args...), nil
+	})
+	RegisterFilter("last", intFilter(Last))
+	RegisterFilter("nl", noArgFilter(func() Filter { return NumberLines() }))
+	RegisterFilter("numbers", func(args []string) (Filter, error) {
+		n, err := intArgs(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return Numbers(n[0], n[1]), nil
+	})
+	RegisterFilter("reverse", noArgFilter(Reverse))
+	RegisterFilter("sample", intFilter(Sample))
+	RegisterFilter("sh", func(args []string) (Filter, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want a single script")
+		}
+		return Shell(args[0]), nil
+	})
+	RegisterFilter("sort", parseSort)
+	RegisterFilter("uniq", func(args []string) (Filter, error) {
+		switch {
+		case len(args) == 0:
+			return Uniq(), nil
+		case len(args) == 1 && args[0] == "-c":
+			return UniqWithCount(), nil
+		case len(args) == 2 && args[0] == "-k":
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return Uniq().Column(n), nil
+		}
+		return nil, fmt.Errorf("want [-c | -k n]")
+	})
+	RegisterFilter("xargs", func(args []string) (Filter, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing command")
+		}
+		return Xargs(args[0], args[1:]...), nil
+	})
+}
+
+// parseSort builds a SortFilter from sort keys like "-n 2".
+func parseSort(args []string) (Filter, error) {
+	s := Sort()
+	keys := map[string]func(int) *SortFilter{
+		"-t":  s.Text,
+		"-n":  s.Num,
+		"-tr": s.TextDecreasing,
+		"-nr": s.NumDecreasing,
+		"-h":  s.HumanSize,
+		"-hr": s.HumanSizeDecreasing,
+		"-V":  s.Version,
+		"-Vr": s.VersionDecreasing,
+		"-M":  s.Month,
+	}
+	for len(args) > 0 {
+		if args[0] == "-u" {
+			s.Unique()
+			args = args[1:]
+			continue
+		}
+		key, ok := keys[args[0]]
+		if !ok || len(args) < 2 {
+			return nil, fmt.Errorf("bad sort key %q", strings.Join(args, " "))
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, err
+		}
+		key(n)
+		args = args[2:]
+	}
+	return s, nil
+}
+
+// parseComm builds a CommFilter from comm flags like "-23" and a
+// file name.
+func parseComm(args []string) (Filter, error) {
+	var hide [3]bool
+	for len(args) > 1 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		for _, c := range args[0][1:] {
+			if c < '1' || c > '3' {
+				return nil, fmt.Errorf("bad flag %q", args[0])
+			}
+			hide[c-'1'] = true
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("want [-123] file")
+	}
+	if hide == [3]bool{true, true, true} {
+		return nil, fmt.Errorf("all columns suppressed")
+	}
+	c := Comm(Cat(args[0]))
+	if !hide[0] {
+		c.OnlyInInput()
+	}
+	if !hide[1] {
+		c.OnlyInOther()
+	}
+	if !hide[2] {
+		c.InBoth()
+	}
+	return c, nil
+}
+
+// intFilter returns a FilterMaker for a filter with a single integer
+// argument.
+func intFilter(fn func(int) Filter) FilterMaker {
+	return func(args []string) (Filter, error) {
+		n, err := intArgs(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return fn(n[0]), nil
+	}
+}
+
+// noArgFilter returns a FilterMaker for a filter without arguments.
+func noArgFilter(fn func() Filter) FilterMaker {
+	return func(args []string) (Filter, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("unexpected arguments %q", args)
+		}
+		return fn(), nil
+	}
+}
+
+// intArgs converts args to integers. If want is not negative, exactly
+// want arguments are required.
+func intArgs(args []string, want int) ([]int, error) {
+	if want >= 0 && len(args) != want {
+		return nil, fmt.Errorf("want %d numeric arguments, got %d", want, len(args))
+	}
+	result := make([]int, len(args))
+	for i, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = n
+	}
+	return result, nil
+}
+
+// splitPipeline splits a pipeline description into stages, and each
+// stage into words, handling shell-like quoting.
+func splitPipeline(s string) ([][]string, error) {
+	var stages [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			endWord()
+		case c == '|':
+			endWord()
+			stages = append(stages, words)
+			words = nil
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`$"\`+"`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endWord()
+	return append(stages, words), nil
+}
@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ResolveFilter is a Filter that treats each input item as a
+// filesystem path and yields a resolved form of the path.
+type ResolveFilter struct {
+	resolve func(string) (string, error)
+	skip    bool // Drop items that fail to resolve
+	keep    bool // Yield items that fail to resolve unchanged
+}
+
+// Abs returns a filter that yields the absolute form of every input
+// path. By default, a path that cannot be made absolute is handled
+// by the error policy of the pipeline (see OnError). This can be
+// adjusted by calling SkipFailures or KeepFailures.
+func Abs() *ResolveFilter {
+	return &ResolveFilter{resolve: filepath.Abs}
+}
+
+// EvalSymlinks returns a filter that yields every input path with
+// all symbolic links resolved. By default, a path that cannot be
+// resolved (e.g., because it does not exist) is handled by the error
+// policy of the pipeline (see OnError). This can be adjusted by
+// calling SkipFailures or KeepFailures.
+func EvalSymlinks() *ResolveFilter {
+	return &ResolveFilter{resolve: filepath.EvalSymlinks}
+}
+
+// SkipFailures adjusts r so that items that fail to resolve are
+// dropped instead of causing an error.
+func (r *ResolveFilter) SkipFailures() *ResolveFilter {
+	r.skip, r.keep = true, false
+	return r
+}
+
+// KeepFailures adjusts r so that items that fail to resolve are
+// yielded unchanged instead of causing an error.
+func (r *ResolveFilter) KeepFailures() *ResolveFilter {
+	r.skip, r.keep = false, true
+	return r
+}
+
+// RunFilter yields the resolved form of every input path. It
+// implements the Filter interface.
+func (r *ResolveFilter) RunFilter(arg Arg) error {
+	for s := range arg.In {
+		p, err := r.resolve(s)
+		switch {
+		case err == nil:
+			arg.Out <- p
+		case r.keep:
+			arg.Out <- s
+		case !r.skip:
+			if err := arg.Fail(s, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExistsFilter is a Filter that treats each input item as a
+// filesystem path and selects items based on whether or not the path
+// exists.
+type ExistsFilter struct {
+	want   bool // Whether to keep existing or missing paths
+	ifmode func(os.FileMode) bool
+}
+
+// IfExists returns a filter that yields every input path that exists.
+// Symbolic links are followed. The filter can be restricted to
+// particular types of files by calling IfMode.
+func IfExists() *ExistsFilter {
+	return &ExistsFilter{
+		want:   true,
+		ifmode: func(os.FileMode) bool { return true },
+	}
+}
+
+// IfNotExists returns a filter that yields every input path that does
+// not exist. Symbolic links are followed. If IfMode is called, paths
+// that exist but do not match are also yielded.
+func IfNotExists() *ExistsFilter {
+	return &ExistsFilter{
+		want:   false,
+		ifmode: func(os.FileMode) bool { return true },
+	}
+}
+
+// IfMode adjusts e so that a path only counts as existing if fn(mode)
+// returns true for it. E.g., IfExists().IfMode(os.FileMode.IsDir)
+// yields only paths that name existing directories.
+func (e *ExistsFilter) IfMode(fn func(os.FileMode) bool) *ExistsFilter {
+	e.ifmode = fn
+	return e
+}
+
+// RunFilter yields the selected paths. It implements the Filter
+// interface.
+func (e *ExistsFilter) RunFilter(arg Arg) error {
+	for s := range arg.In {
+		st, err := os.Stat(s)
+		exists := err == nil && e.ifmode(st.Mode())
+		if exists == e.want {
+			arg.Out <- s
+		}
+	}
+	return nil
+}
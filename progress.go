@@ -0,0 +1,170 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProgressStatus describes the progress of items through a
+// ProgressFilter.
+type ProgressStatus struct {
+	Items   int           // Number of items seen so far
+	Total   int           // Expected number of items, or 0 if unknown
+	Elapsed time.Duration // Time since the filter started
+	Rate    float64       // Items per second
+	ETA     time.Duration // Estimated time remaining, or 0 if unknown
+	Done    bool          // All items have been seen
+}
+
+// String returns a one-line description of p, e.g.,
+//
+//	1200 items in 4s (300/s)
+//	1200/5000 items (24%) in 4s (300/s), ETA 13s
+func (p ProgressStatus) String() string {
+	elapsed := p.Elapsed.Round(time.Second)
+	if p.Total <= 0 {
+		return fmt.Sprintf("%d items in %v (%.0f/s)", p.Items, elapsed, p.Rate)
+	}
+	s := fmt.Sprintf("%d/%d items (%d%%) in %v (%.0f/s)",
+		p.Items, p.Total, 100*p.Items/p.Total, elapsed, p.Rate)
+	if !p.Done && p.ETA > 0 {
+		s += fmt.Sprintf(", ETA %v", p.ETA.Round(time.Second))
+	}
+	return s
+}
+
+// ProgressFilter is a Filter that passes its input through unchanged
+// while reporting how many items have passed.
+type ProgressFilter struct {
+	fn       func(ProgressStatus)
+	every    int
+	interval time.Duration
+	total    int
+}
+
+// Progress returns a filter that copies its input to its output and
+// writes a line describing its progress (see ProgressStatus.String)
+// to w after every 1000 items, and once more when its input is
+// exhausted. The frequency of reports can be adjusted by calling
+// Every and Interval.
+func Progress(w io.Writer) *ProgressFilter {
+	return ProgressFunc(func(p ProgressStatus) { fmt.Fprintln(w, p) })
+}
+
+// ProgressFunc is like Progress, but calls fn with the current status
+// instead of writing lines to a writer.
+func ProgressFunc(fn func(ProgressStatus)) *ProgressFilter {
+	return &ProgressFilter{fn: fn, every: 1000}
+}
+
+// Every adjusts p so that progress is reported after every n items.
+// If n is zero, reports are not triggered by item counts.
+func (p *ProgressFilter) Every(n int) *ProgressFilter {
+	p.every = n
+	return p
+}
+
+// Interval adjusts p so that progress is reported every d, even if
+// no items have arrived since the last report. Interval can be
+// combined with Every; use Every(0) to report only based on time.
+func (p *ProgressFilter) Interval(d time.Duration) *ProgressFilter {
+	p.interval = d
+	return p
+}
+
+// Total adjusts p so that the expected number of items is n. Reports
+// then include the percentage of items seen and an estimate of the
+// remaining time.
+func (p *ProgressFilter) Total(n int) *ProgressFilter {
+	p.total = n
+	return p
+}
+
+// RunFilter copies input to output, reporting progress. It
+// implements the Filter interface.
+func (p *ProgressFilter) RunFilter(arg Arg) error {
+	clock := arg.Clock()
+	start := clock.Now()
+	n := 0
+	report := func(done bool) {
+		st := ProgressStatus{Items: n, Total: p.total, Elapsed: clock.Now().Sub(start), Done: done}
+		if secs := st.Elapsed.Seconds(); secs > 0 {
+			st.Rate = float64(n) / secs
+		}
+		if st.Total > n && st.Rate > 0 {
+			st.ETA = time.Duration(float64(st.Total-n) / st.Rate * float64(time.Second))
+		}
+		p.fn(st)
+	}
+	var tick <-chan time.Time
+	if p.interval > 0 {
+		t := clock.NewTicker(p.interval)
+		defer t.Stop()
+		tick = t.C()
+	}
+	for {
+		select {
+		case s, ok := <-arg.In:
+			if !ok {
+				report(true)
+				return nil
+			}
+			arg.Out <- s
+			n++
+			if p.every > 0 && n%p.every == 0 {
+				report(false)
+			}
+		case <-tick:
+			report(false)
+		}
+	}
+}
+
+// ProgressBar returns a filter that copies its input to its output
+// and displays its progress on w (typically os.Stderr). If w is a
+// terminal, a single line holding a progress bar (if the expected
+// total is known; see Total), the item count, and the rate is
+// rewritten in place several times a second. Otherwise a plain line
+// (see ProgressStatus.String) is written every five seconds. In both
+// cases, a final line is written when the input is exhausted. E.g.,
+//
+//	stream.Run(
+//		stream.Find(dir).IfMode(os.FileMode.IsRegular),
+//		stream.ProgressBar(os.Stderr),
+//		...
+//	)
+func ProgressBar(w io.Writer) *ProgressFilter {
+	if f, ok := w.(*os.File); !ok || !isTerminal(f) {
+		return Progress(w).Every(0).Interval(5 * time.Second)
+	}
+	return ProgressFunc(func(p ProgressStatus) {
+		fmt.Fprintf(w, "\r\x1b[K%s", progressLine(p))
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}).Every(0).Interval(200 * time.Millisecond)
+}
+
+// progressBarWidth is the number of characters in a progress bar.
+const progressBarWidth = 30
+
+// progressLine returns the text displayed by ProgressBar on a
+// terminal for p.
+func progressLine(p ProgressStatus) string {
+	if p.Total <= 0 {
+		return p.String()
+	}
+	filled := progressBarWidth * p.Items / p.Total
+	filled = min(max(filled, 0), progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	return fmt.Sprintf("[%s] %s", bar, p)
+}
+
+// isTerminal returns true if f appears to be a terminal.
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
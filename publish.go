@@ -0,0 +1,169 @@
+package stream
+
+import (
+	"expvar"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PublishedCollector is a Collector that accumulates per-stage
+// counters and histograms over all the pipelines that report to it,
+// and makes them available via the expvar package, and therefore via
+// the /debug/vars HTTP endpoint of programs that import expvar.
+//
+// This package does not depend on prometheus/client_golang, so it
+// does not register Prometheus metrics itself. A prometheus.Collector
+// can be written by converting the result of Totals: the counters map
+// to counter metrics and the histograms, which hold non-cumulative
+// bucket counts, to histogram metrics.
+type PublishedCollector struct {
+	mu       sync.Mutex
+	finished map[string]*StageTotals   // Totals of finished executions
+	running  map[uint64][]StageMetrics // Latest metrics of running executions
+}
+
+// StageTotals holds the accumulated metrics for the stages with a
+// given key (see PublishMetrics).
+type StageTotals struct {
+	Executions int64 // Finished executions that included the stage
+	ItemsIn    int64
+	ItemsOut   int64
+	BytesIn    int64
+	BytesOut   int64
+	Active     time.Duration
+	Blocked    time.Duration
+
+	// Seconds and Items are histograms of the time spent by the stage
+	// (Active plus Blocked) and of the number of items it wrote, with
+	// one observation per finished execution.
+	Seconds Histogram
+	Items   Histogram
+}
+
+// Histogram counts observations in buckets. Counts[i] is the number
+// of observations v with Bounds[i-1] < v <= Bounds[i], and the last
+// entry of Counts is the number of observations above every bound.
+type Histogram struct {
+	Bounds []float64 // Upper bounds of the buckets, in increasing order
+	Counts []int64   // Nil if there are no observations
+	Count  int64     // Number of observations
+	Sum    float64   // Sum of observations
+}
+
+// Observe adds v to h.
+func (h *Histogram) Observe(v float64) {
+	if h.Counts == nil {
+		h.Counts = make([]int64, len(h.Bounds)+1)
+	}
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+}
+
+// Buckets of the histograms in StageTotals.
+var (
+	secondsBounds = []float64{0.001, 0.01, 0.1, 1, 10, 100, 1000}
+	itemsBounds   = []float64{1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7}
+)
+
+// PublishMetrics returns a Collector that publishes metrics as the
+// expvar variable name. The variable holds a JSON object that maps
+// the key of every stage to its StageTotals. The key of a stage is
+// the name given to it by Named, or else its position in the pipeline
+// (starting at "0"), so the stages of different pipelines reporting
+// to the collector are only kept apart if they are named. E.g.,
+//
+//	c := stream.PublishMetrics("pipeline")
+//	r := stream.NewRunner(stream.WithCollector(c, time.Second))
+//
+// As with expvar.Publish, PublishMetrics panics if name is already
+// in use.
+func PublishMetrics(name string) *PublishedCollector {
+	c := &PublishedCollector{
+		finished: map[string]*StageTotals{},
+		running:  map[uint64][]StageMetrics{},
+	}
+	expvar.Publish(name, expvar.Func(func() any { return c.Totals() }))
+	return c
+}
+
+// stageKey returns the key under which the metrics of m are
+// accumulated.
+func stageKey(m StageMetrics) string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return strconv.Itoa(m.Index)
+}
+
+// Collect records the metrics for stages. It implements the Collector
+// interface.
+func (c *PublishedCollector) Collect(stages []StageMetrics) {
+	if len(stages) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	execution := stages[0].Execution
+	if !stages[0].Final {
+		c.running[execution] = append(c.running[execution][:0], stages...)
+		return
+	}
+	delete(c.running, execution)
+	for _, m := range stages {
+		t := c.finished[stageKey(m)]
+		if t == nil {
+			t = newStageTotals()
+			c.finished[stageKey(m)] = t
+		}
+		t.add(m)
+		t.Executions++
+		t.Seconds.Observe((m.Active + m.Blocked).Seconds())
+		t.Items.Observe(float64(m.ItemsOut))
+	}
+}
+
+// Totals returns the accumulated metrics of every stage. The counters
+// include the progress of executions that have not finished yet; the
+// histograms only cover finished executions.
+func (c *PublishedCollector) Totals() map[string]StageTotals {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := map[string]StageTotals{}
+	for k, t := range c.finished {
+		r := *t
+		r.Seconds.Counts = append([]int64(nil), t.Seconds.Counts...)
+		r.Items.Counts = append([]int64(nil), t.Items.Counts...)
+		result[k] = r
+	}
+	for _, stages := range c.running {
+		for _, m := range stages {
+			r, ok := result[stageKey(m)]
+			if !ok {
+				r = *newStageTotals()
+			}
+			r.add(m)
+			result[stageKey(m)] = r
+		}
+	}
+	return result
+}
+
+func newStageTotals() *StageTotals {
+	return &StageTotals{
+		Seconds: Histogram{Bounds: secondsBounds},
+		Items:   Histogram{Bounds: itemsBounds},
+	}
+}
+
+// add adds the counters of m to t.
+func (t *StageTotals) add(m StageMetrics) {
+	t.ItemsIn += m.ItemsIn
+	t.ItemsOut += m.ItemsOut
+	t.BytesIn += m.BytesIn
+	t.BytesOut += m.BytesOut
+	t.Active += m.Active
+	t.Blocked += m.Blocked
+}
@@ -0,0 +1,25 @@
+package stream
+
+import "strings"
+
+// ShellQuote quotes each item so that a POSIX shell will interpret it
+// as a single word with the same value as the item. Items that
+// consist only of characters that are not special to the shell are
+// not changed. E.g.,
+//
+//	a.txt      is emitted as  a.txt
+//	it's here  is emitted as  'it'\''s here'
+func ShellQuote() Filter {
+	return mapFilter("ShellQuote", shellQuote)
+}
+
+// shellQuote returns s quoted for a POSIX shell.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafe) == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellSafe contains the characters that never need quoting.
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
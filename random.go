@@ -0,0 +1,47 @@
+package stream
+
+import "fmt"
+
+// RandomStrings emits n pseudo-random strings, each consisting of
+// length characters drawn uniformly from alphabet. Random numbers are
+// obtained from Arg.Rand, so the output can be made reproducible with
+// WithRand.
+func RandomStrings(n int, alphabet string, length int) Filter {
+	chars := []rune(alphabet)
+	return FilterFunc(func(arg Arg) error {
+		if len(chars) == 0 {
+			return fmt.Errorf("stream.RandomStrings: empty alphabet")
+		}
+		r := arg.Rand()
+		buf := make([]rune, length)
+		for i := 0; i < n; i++ {
+			for j := range buf {
+				buf[j] = chars[r.Intn(len(chars))]
+			}
+			if err := arg.Send(string(buf)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UUIDs emits n pseudo-random (version 4) UUIDs in their canonical
+// textual form, e.g., "f47ac10b-58cc-4372-a567-0e02b2c3d479". Random
+// numbers are obtained from Arg.Rand, so the UUIDs are not suitable
+// where unpredictability matters.
+func UUIDs(n int) Filter {
+	return FilterFunc(func(arg Arg) error {
+		r := arg.Rand()
+		var u [16]byte
+		for i := 0; i < n; i++ {
+			r.Read(u[:])
+			u[6] = u[6]&0x0f | 0x40 // Version 4
+			u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+			if err := arg.Send(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Reconcile returns a filter that compares the contents of the
+// directory trees dirA and dirB and yields one item per difference,
+// in path order:
+//
+//	added path	path exists under dirB but not under dirA
+//	removed path	path exists under dirA but not under dirB
+//	changed path	path exists under both, with different contents
+//
+// Paths are relative to dirA and dirB. Regular files are compared by
+// a SHA-256 hash of their contents (computed in parallel). Symbolic
+// links are not followed: they are compared by their targets, and a
+// symbolic link is always different from a regular file. Other
+// files, such as named pipes and devices, are never opened: they are
+// compared by their type only. Directories themselves are not
+// reported. Any error encountered while reading either tree causes
+// the filter to fail.
+func Reconcile(dirA, dirB string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		a, err := treeDigests(arg, dirA)
+		if err != nil {
+			return err
+		}
+		b, err := treeDigests(arg, dirB)
+		if err != nil {
+			return err
+		}
+		var paths []string
+		for p := range a {
+			paths = append(paths, p)
+		}
+		for p := range b {
+			if _, ok := a[p]; !ok {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			da, inA := a[p]
+			db, inB := b[p]
+			switch {
+			case !inA:
+				arg.Out <- "added " + p
+			case !inB:
+				arg.Out <- "removed " + p
+			case da != db:
+				arg.Out <- "changed " + p
+			}
+		}
+		return nil
+	})
+}
+
+// treeDigests returns a map from the relative path of every
+// non-directory under dir to a digest of its contents.
+func treeDigests(arg Arg, dir string) (map[string]string, error) {
+	digest := FilterFunc(func(arg Arg) error {
+		for p := range arg.In {
+			d, err := fileDigest(filepath.Join(dir, p))
+			if err != nil {
+				return err
+			}
+			arg.Out <- d + " " + p
+		}
+		return nil
+	})
+	result := map[string]string{}
+	err := forEach(arg.env, Sequence(
+		Find(dir).Relative().IfMode(func(m os.FileMode) bool { return !m.IsDir() }),
+		Parallel(runtime.NumCPU(), digest),
+	), func(s string) {
+		i := strings.IndexByte(s, ' ')
+		result[s[i+1:]] = s[:i]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fileDigest returns a string that identifies the contents of the
+// file or symbolic link named by path. Only regular files are read;
+// any other kind of file is identified by its type, since opening a
+// named pipe or a device could block.
+func fileDigest(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	switch mode := info.Mode(); {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return "link:" + hex.EncodeToString([]byte(target)), nil
+	case !mode.IsRegular():
+		return "special:" + hex.EncodeToString([]byte(mode.Type().String())), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "file:" + hex.EncodeToString(h.Sum(nil)), nil
+}
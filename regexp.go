@@ -1,6 +1,13 @@
 package stream
 
-import "regexp"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
 
 // Grep emits every input x that matches the regular expression r.
 func Grep(r string) Filter {
@@ -8,7 +15,7 @@ func Grep(r string) Filter {
 	if err != nil {
 		return FilterFunc(func(Arg) error { return err })
 	}
-	return If(re.MatchString)
+	return ifFilter("Grep", re.MatchString)
 }
 
 // GrepNot emits every input x that does not match the regular expression r.
@@ -17,7 +24,65 @@ func GrepNot(r string) Filter {
 	if err != nil {
 		return FilterFunc(func(Arg) error { return err })
 	}
-	return If(func(s string) bool { return !re.MatchString(s) })
+	return ifFilter("GrepNot", func(s string) bool { return !re.MatchString(s) })
+}
+
+// GrepFiles emits every line that matches the regular expression r
+// in every regular file found under the directories roots (see
+// Find). Each matching line is emitted as "path:lineno:text", like
+// the output of "grep -rn". Line numbers start at 1. Lines may be
+// arbitrarily long. A file that cannot be read is handled by the
+// error policy of the pipeline (see OnError): by default, GrepFiles
+// fails.
+func GrepFiles(r string, roots ...string) Filter {
+	re, err := regexp.Compile(r)
+	if err != nil {
+		return FilterFunc(func(Arg) error { return err })
+	}
+	return Sequence(
+		Find(roots...).IfMode(os.FileMode.IsRegular),
+		FilterFunc(func(arg Arg) error {
+			for path := range arg.In {
+				sendErr, err := grepFile(re, path, arg)
+				if sendErr != nil {
+					return sendErr
+				}
+				if err != nil {
+					if err := arg.Fail(path, err); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}),
+	)
+}
+
+// grepFile emits the lines of the file path that match re. It returns
+// the error from sending a line separately from the error from reading
+// the file, since only the latter is specific to the file.
+func grepFile(re *regexp.Regexp, path string, arg Arg) (sendErr, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		s, err := rd.ReadString('\n')
+		if err != nil && (err != io.EOF || s == "") {
+			if err == io.EOF {
+				err = nil
+			}
+			return nil, err
+		}
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+		if re.MatchString(s) {
+			if err := arg.Send(fmt.Sprintf("%s:%d:%s", path, line, s)); err != nil {
+				return err, nil
+			}
+		}
+	}
 }
 
 // Substitute replaces all occurrences of the regular expression r in
@@ -35,3 +100,74 @@ func Substitute(r, replacement string) Filter {
 		return nil
 	})
 }
+
+// DeleteMatch removes all occurrences of the regular expression r
+// from every input item.
+func DeleteMatch(r string) Filter {
+	return Substitute(r, "")
+}
+
+// KeepOnly emits every match of the regular expression r in every
+// input item as a separate item (like "grep -o"). Items without a
+// match produce no output.
+func KeepOnly(r string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return err
+		}
+		for s := range arg.In {
+			for _, m := range re.FindAllString(s, -1) {
+				arg.Out <- m
+			}
+		}
+		return nil
+	})
+}
+
+// TakeUntilFilter is a Filter that yields items up to the first one
+// that matches a regular expression.
+type TakeUntilFilter struct {
+	r         string
+	inclusive bool
+}
+
+// TakeUntil yields its input items up to, but not including, the first
+// one that matches the regular expression r. Once it has seen that
+// item, the preceding filters are told to stop producing items (see
+// ErrStopped), like with First. E.g., the following prints the header
+// of a mail message:
+//
+//	stream.Run(
+//		stream.Cat("message.eml"),
+//		stream.TakeUntil(`^$`),
+//		stream.WriteLines(os.Stdout),
+//	)
+func TakeUntil(r string) *TakeUntilFilter {
+	return &TakeUntilFilter{r: r}
+}
+
+// Inclusive adjusts t so that the matching item is yielded as well.
+func (t *TakeUntilFilter) Inclusive() *TakeUntilFilter {
+	t.inclusive = true
+	return t
+}
+
+// RunFilter yields the items before the match. It implements the
+// Filter interface.
+func (t *TakeUntilFilter) RunFilter(arg Arg) error {
+	re, err := regexp.Compile(t.r)
+	if err != nil {
+		return err
+	}
+	for s := range arg.In {
+		if re.MatchString(s) {
+			if t.inclusive {
+				arg.Out <- s
+			}
+			break
+		}
+		arg.Out <- s
+	}
+	return nil
+}
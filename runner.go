@@ -0,0 +1,371 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Runner executes filters like Run, ForEach, and Contents, but also
+// makes a context, a logger, and a reporter of non-fatal errors
+// available to the filters via Arg methods.
+type Runner struct {
+	env             runEnv
+	watchdog        *watchdog
+	collector       Collector
+	collectInterval time.Duration
+	middleware      []Middleware
+}
+
+// runEnv holds the services shared by the filters in a pipeline.
+type runEnv struct {
+	ctx       context.Context
+	logger    *slog.Logger
+	report    func(error)
+	onError   func(error) Action
+	maxErrors int
+	errors    *errorCounter // Per-execution; nil if errors are not counted
+	budget    int64
+	memory    *memoryBudget // Per-execution; nil if memory is not limited
+	clock     Clock
+	rand      rand.Source // Nil if not supplied by WithRand
+	batchSize int         // Items per batch; batching is off if <= 1
+	lazy      bool        // Evaluate pipelines lazily
+}
+
+// errorCounter counts the errors encountered during the execution of
+// a pipeline and cancels the pipeline when there are too many.
+type errorCounter struct {
+	mu     sync.Mutex
+	n      int
+	seen   map[errorKey]error // Stage errors already counted
+	cancel context.CancelFunc
+}
+
+// add counts err unless it has already been counted (e.g., errors
+// returned by a nested stage are seen again by enclosing stages). It
+// returns true if the limit max has been reached.
+func (c *errorCounter) add(err error, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.markSeen(err) {
+		c.n++
+	}
+	if c.n >= max {
+		c.cancel()
+		return true
+	}
+	return false
+}
+
+// markSeen records err and returns true if it, or an error wrapped
+// by it, was recorded before. Errors are identified by their address,
+// so distinct failures with the same message are counted separately.
+// Errors that are not pointers cannot be identified and are never
+// seen.
+func (c *errorCounter) markSeen(err error) (seen bool) {
+	for e := err; e != nil && !seen; e = errors.Unwrap(e) {
+		if k, ok := keyOf(e); ok {
+			_, seen = c.seen[k]
+		}
+	}
+	if k, ok := keyOf(err); ok {
+		c.seen[k] = err // Keeps err alive so that its address is not reused
+	}
+	return seen
+}
+
+// errorKey identifies an error in errorCounter.seen. Errors are not
+// used as keys themselves since not all of them are comparable, and
+// equal errors may describe different failures.
+type errorKey struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// keyOf returns the key of err, or false if err is not a pointer.
+func keyOf(err error) (errorKey, bool) {
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Pointer {
+		return errorKey{}, false
+	}
+	return errorKey{v.Type(), v.Pointer()}, true
+}
+
+// count returns the number of errors counted so far.
+func (c *errorCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// ErrTooManyErrors is returned (wrapped) by a pipeline that was
+// cancelled because it encountered too many errors (see MaxErrors).
+var ErrTooManyErrors = errors.New("stream: too many errors")
+
+// MaxErrors arranges for a pipeline to be cancelled (see
+// Arg.Context) once n errors have occurred. Both errors returned by
+// filters and failures to process items (see Arg.Fail) are counted,
+// even failures that were skipped because of ContinueOnError or
+// OnError. Once the limit is reached, Arg.Fail aborts the filter that
+// called it, and the pipeline returns an error that wraps
+// ErrTooManyErrors.
+func MaxErrors(n int) RunOption {
+	return func(r *Runner) { r.env.maxErrors = n }
+}
+
+// RunOption configures a Runner.
+type RunOption func(*Runner)
+
+// NewRunner returns a Runner configured by opts.
+func NewRunner(opts ...RunOption) *Runner {
+	r := &Runner{env: runEnv{
+		ctx:    context.Background(),
+		logger: slog.New(slog.DiscardHandler),
+	}}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+var defaultRunner = NewRunner()
+
+// WithContext makes ctx available to filters via Arg.Context.
+func WithContext(ctx context.Context) RunOption {
+	return func(r *Runner) { r.env.ctx = ctx }
+}
+
+// WithLogger makes logger available to filters via Arg.Logger. The
+// package also uses logger for its own diagnostics: the start and
+// finish of every top-level stage and the exit of every command
+// executed by Command or Xargs are logged at level Debug; stalls
+// detected by WithWatchdog and non-fatal errors reported without a
+// reporter (see Arg.Report) are logged at level Warn.
+func WithLogger(logger *slog.Logger) RunOption {
+	return func(r *Runner) { r.env.logger = logger }
+}
+
+// WithReporter arranges for fn to be called with every non-fatal error
+// reported by a filter via Arg.Report. fn may be called concurrently
+// from multiple filters.
+func WithReporter(fn func(error)) RunOption {
+	return func(r *Runner) { r.env.report = fn }
+}
+
+// withContext returns a copy of r that uses ctx as the context of
+// the pipeline.
+func (r *Runner) withContext(ctx context.Context) *Runner {
+	c := *r
+	c.env.ctx = ctx
+	return &c
+}
+
+// Run executes the sequence of filters and discards all output.
+// It returns either nil, an error if any filter reported an error.
+func (r *Runner) Run(filters ...Filter) error {
+	return r.forEach(filters, func(s string) bool { return true })
+}
+
+// ForEach calls fn(s) for every item s in the output of filter and
+// returns either nil, or any error reported by the execution of the filter.
+func (r *Runner) ForEach(filter Filter, fn func(s string)) error {
+	return r.forEach([]Filter{filter}, func(s string) bool {
+		fn(s)
+		return true
+	})
+}
+
+// ForEachWhile calls fn(s) for every item s in the output of filter
+// until fn returns false. The filters then stop producing items (see
+// ErrStopped). It returns either nil, or any error reported by the
+// execution of the filter.
+func (r *Runner) ForEachWhile(filter Filter, fn func(s string) bool) error {
+	return r.forEach([]Filter{filter}, fn)
+}
+
+// Contents returns a slice that contains all items that are
+// the output of filters.
+func (r *Runner) Contents(filters ...Filter) ([]string, error) {
+	var result []string
+	err := r.forEach(filters, func(s string) bool {
+		result = append(result, s)
+		return true
+	})
+	if err != nil {
+		result = nil // Discard results on error
+	}
+	return result, err
+}
+
+// forEach calls fn(s) for every item s in the output of the sequence
+// of filters until fn returns false.
+func (r *Runner) forEach(filters []Filter, fn func(s string) bool) error {
+	if len(filters) == 1 {
+		if q, ok := filters[0].(*sequence[string]); ok {
+			filters = q.filters // Report the stages of the sequence
+		}
+	}
+	filters = r.applyMiddleware(filters)
+	stages := make([]Filter, len(filters))
+	for i, f := range filters {
+		stages[i] = &topStage{index: i, f: f}
+	}
+	filters = stages
+	env := r.env
+	if env.maxErrors > 0 {
+		ctx, cancel := context.WithCancel(env.ctx)
+		defer cancel()
+		env.ctx = ctx
+		env.errors = &errorCounter{seen: map[errorKey]error{}, cancel: cancel}
+	}
+	if env.budget > 0 {
+		env.memory = &memoryBudget{limit: env.budget}
+	}
+	var err error
+	if r.watchdog != nil || r.collector != nil {
+		err = r.observe(&env, filters, fn)
+	} else if env.lazy {
+		err = forEachLazy(&env, filters, fn)
+	} else if env.batchSize > 1 {
+		err = forEachBatched(&env, filters, fn)
+	} else {
+		err = forEachWhile(&env, Sequence(filters...), fn)
+	}
+	if env.errors != nil && env.errors.count() >= env.maxErrors {
+		return fmt.Errorf("%w (%d): %w", ErrTooManyErrors, env.errors.count(), err)
+	}
+	return err
+}
+
+// topStage is a top-level stage of a pipeline. Its errors are
+// wrapped in a *StageError, and its start and finish are logged at
+// level Debug.
+type topStage struct {
+	index int
+	f     Filter
+}
+
+func (t *topStage) RunFilter(arg Arg) error {
+	run := t.f.RunFilter
+	if n, ok := t.f.(*namedFilter); ok {
+		run = n.run // The name is part of the StageError
+	}
+	return t.run(arg.Logger(), arg.Context(), func() error { return run(arg) })
+}
+
+// run calls fn, which runs t.f, with the logging and error handling
+// of a top-level stage.
+func (t *topStage) run(logger *slog.Logger, ctx context.Context, fn func() error) error {
+	debug := logger.Enabled(ctx, slog.LevelDebug)
+	if debug {
+		logger = logger.With("stage", t.index)
+		if name := filterName(t.f); name != "" {
+			logger = logger.With("name", name)
+		}
+		logger.Debug("stream: stage started")
+	}
+	start := time.Now()
+	err := recoverPanic(t.f, fn)
+	if debug {
+		logger.Debug("stream: stage finished", "elapsed", time.Since(start), "err", err)
+	}
+	if err != nil {
+		err = &StageError{Stage: t.index + 1, Name: stageName(t.f), Err: err}
+	}
+	return err
+}
+
+// forEach calls fn(s) for every item s in the output of filter, which
+// is executed with the services in env.
+func forEach(env *runEnv, filter Filter, fn func(s string)) error {
+	return forEachWhile(env, filter, func(s string) bool {
+		fn(s)
+		return true
+	})
+}
+
+// forEachWhile is like forEach, but stops the filter once fn returns
+// false.
+func forEachWhile[T, U any](env *runEnv, filter StageOf[T, U], fn func(s U) bool) error {
+	in := make(chan T)
+	close(in)
+	out := make(chan U, channelBuffer)
+	stop := newStopSignal()
+	e := &filterErrors{}
+	go runFilter(filter, ArgOf[T, U]{In: in, Out: out, env: env, outStop: stop}, e)
+	for s := range out {
+		if !fn(s) {
+			stop.raise()
+			break
+		}
+	}
+	for range out { // Discard items produced before the filter stopped
+	}
+	return e.getError()
+}
+
+// Context returns the context of the pipeline that is executing the
+// filter. Filters that run for a long time should stop when the
+// context is done.
+func (a ArgOf[T, U]) Context() context.Context {
+	if a.env == nil {
+		return context.Background()
+	}
+	return a.env.ctx
+}
+
+// Send emits s on a.Out. If the context of the pipeline (see Context)
+// is done first, Send returns the context's error instead, and if the
+// rest of the pipeline wants no more items, it returns ErrStopped.
+// Filters that produce many items without reading a.In should use
+// Send and return its error so that they stop promptly when their
+// output is no longer needed. E.g.,
+//
+//	for {
+//		if err := arg.Send(next()); err != nil {
+//			return err
+//		}
+//	}
+func (a ArgOf[T, U]) Send(s U) error {
+	done, stop := a.Context().Done(), a.outStop.done()
+	if done == nil && stop == nil {
+		a.Out <- s
+		return nil
+	}
+	select {
+	case a.Out <- s:
+		return nil
+	case <-done:
+		return a.Context().Err()
+	case <-stop:
+		return ErrStopped
+	}
+}
+
+// Logger returns the logger to use for diagnostics from the filter.
+// By default, all log records are discarded.
+func (a ArgOf[T, U]) Logger() *slog.Logger {
+	if a.env == nil {
+		return defaultRunner.env.logger
+	}
+	return a.env.logger
+}
+
+// Report reports a non-fatal error encountered by the filter. Unlike
+// returning an error from RunFilter, reporting an error does not stop
+// the pipeline. By default, reported errors are logged at level Warn.
+func (a ArgOf[T, U]) Report(err error) {
+	switch {
+	case err == nil:
+	case a.env != nil && a.env.report != nil:
+		a.env.report(err)
+	default:
+		a.Logger().Warn("stream: non-fatal error", "err", err)
+	}
+}
@@ -1,14 +1,17 @@
 package stream
 
 import (
+	"fmt"
 	"math/rand"
-	"time"
 )
 
 // Sample picks n pseudo-randomly chosen input items.  Different executions
-// of a Sample filter will chose different items.
+// of a Sample filter will chose different items, unless the pipeline
+// supplies a source of random numbers (see WithRand).
 func Sample(n int) Filter {
-	return SampleWithSeed(n, time.Now().UnixNano())
+	return FilterFunc(func(arg Arg) error {
+		return sample(arg, n, arg.Rand())
+	})
 }
 
 // SampleWithSeed picks n pseudo-randomly chosen input items. It uses
@@ -17,24 +20,66 @@ func Sample(n int) Filter {
 // chose the same items.
 func SampleWithSeed(n int, seed int64) Filter {
 	return FilterFunc(func(arg Arg) error {
-		// Could speed this up by using Algorithm Z from Vitter.
-		r := rand.New(rand.NewSource(seed))
-		reservoir := make([]string, 0, n)
-		i := 0
-		for s := range arg.In {
-			if i < n {
-				reservoir = append(reservoir, s)
-			} else {
-				j := r.Intn(i + 1)
-				if j < n {
-					reservoir[j] = s
-				}
+		return sample(arg, n, rand.New(rand.NewSource(seed)))
+	})
+}
+
+// sample picks n items using random numbers from r.
+func sample(arg Arg, n int, r *rand.Rand) error {
+	// Could speed this up by using Algorithm Z from Vitter.
+	reservoir := make([]string, 0, n)
+	i := 0
+	for s := range arg.In {
+		if i < n {
+			reservoir = append(reservoir, s)
+		} else {
+			j := r.Intn(i + 1)
+			if j < n {
+				reservoir[j] = s
 			}
-			i++
 		}
-		for _, s := range reservoir {
+		i++
+	}
+	for _, s := range reservoir {
+		arg.Out <- s
+	}
+	return nil
+}
+
+// EveryNthFilter is a Filter that yields every nth input item.
+type EveryNthFilter struct {
+	n, offset int
+}
+
+// EveryNth yields every nth input item, starting with the first one,
+// i.e., the items at positions 0, n, 2n, ... (counting from zero).
+// Unlike Sample, the chosen items do not depend on random numbers,
+// which makes EveryNth handy for thinning out very long sequences
+// while debugging a pipeline. The starting position can be adjusted
+// by calling Offset.
+func EveryNth(n int) *EveryNthFilter {
+	return &EveryNthFilter{n: n}
+}
+
+// Offset adjusts e so that it yields the items at positions offset,
+// offset+n, offset+2n, ...
+func (e *EveryNthFilter) Offset(offset int) *EveryNthFilter {
+	e.offset = offset
+	return e
+}
+
+// RunFilter yields the chosen items. It implements the Filter
+// interface.
+func (e *EveryNthFilter) RunFilter(arg Arg) error {
+	if e.n <= 0 {
+		return fmt.Errorf("stream.EveryNth: invalid stride %d", e.n)
+	}
+	i := 0
+	for s := range arg.In {
+		if i >= e.offset && (i-e.offset)%e.n == 0 {
 			arg.Out <- s
 		}
-		return nil
-	})
+		i++
+	}
+	return nil
 }
@@ -3,41 +3,93 @@ package stream_test
 import (
 	"github.com/ghemawat/stream"
 
-	"fmt"
+	"slices"
+	"strings"
 	"testing"
 )
 
-// doTest checks that Sample picks items evenly.  "n" samples are
-// drawn from a list of numbers of length "space".  This is repeated
-// "iters" times.  The number of times a particular number is drawn
-// should be within "tolerance" of the expected number.
-func doTest(t *testing.T, n, space, iters int, tolerance float64) {
-	count := make([]int, space)
-	for i := 0; i < iters; i++ {
-		s := stream.Sequence(
-			stream.Numbers(0, space-1),
-			stream.SampleWithSeed(n, int64(i)),
-		)
-		stream.ForEach(s, func(s string) {
-			num := -1 // Will cause panic below if Scan fails
-			fmt.Sscan(s, &num)
-			count[num]++
-		})
+// scriptedSource is a rand.Source that makes rand.Rand.Intn(n) return
+// the given values in order (each value must be less than n).
+type scriptedSource struct {
+	values []int
+	next   int
+}
+
+func (s *scriptedSource) Int63() int64 {
+	v := s.values[s.next]
+	s.next++
+	return int64(v) << 32 // Int31 uses the high bits
+}
+
+func (s *scriptedSource) Seed(int64) {}
+
+// doTest checks that Sample picks items evenly. "n" samples are drawn
+// from a list of numbers of length "space", once for every possible
+// sequence of random choices. Every subset of n numbers must then be
+// picked exactly as often as every other one.
+func doTest(t *testing.T, n, space int) {
+	// choices[k] is the random number used for item n+k, which must
+	// be in [0,n+k]. Step through every combination like an odometer.
+	choices := make([]int, space-n)
+	count := map[string]int{}
+	runs := 0
+	for {
+		src := &scriptedSource{values: choices}
+		r := stream.NewRunner(stream.WithRand(src))
+		out, err := r.Contents(stream.Numbers(0, space-1), stream.Sample(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.next != len(choices) {
+			t.Fatalf("Sample used %d random numbers; expected %d", src.next, len(choices))
+		}
+		slices.Sort(out)
+		count[strings.Join(out, " ")]++
+		runs++
+
+		k := 0
+		for ; k < len(choices); k++ {
+			if choices[k]++; choices[k] <= n+k {
+				break
+			}
+			choices[k] = 0
+		}
+		if k == len(choices) {
+			break
+		}
 	}
 
-	// Check that all counts are approximately equal.
-	expected := (float64(iters) * float64(n)) / float64(space)
-	minExpected := expected * (1.0 - tolerance)
-	maxExpected := expected * (1.0 + tolerance)
-	for i, n := range count {
-		if float64(n) < minExpected || float64(n) > maxExpected {
-			t.Errorf("%d has %d samples; expected range [%f,%f]\n",
-				i, n, minExpected, maxExpected)
+	subsets := 1 // Number of subsets of size n
+	for i := 0; i < n; i++ {
+		subsets = subsets * (space - i) / (i + 1)
+	}
+	if len(count) != subsets {
+		t.Errorf("%d distinct samples; expected %d", len(count), subsets)
+	}
+	for s, c := range count {
+		if c != runs/subsets {
+			t.Errorf("sample %q picked %d times; expected %d", s, c, runs/subsets)
 		}
 	}
 }
 
-func TestSample_1of2(t *testing.T)    { doTest(t, 1, 2, 10000, 0.01) }
-func TestSample_9of10(t *testing.T)   { doTest(t, 9, 10, 1000, 0.05) }
-func TestSample_50of100(t *testing.T) { doTest(t, 50, 100, 1000, 0.15) }
-func TestSample_99of100(t *testing.T) { doTest(t, 99, 100, 100, 0.05) }
+func TestSample_1of2(t *testing.T)  { doTest(t, 1, 2) }
+func TestSample_1of6(t *testing.T)  { doTest(t, 1, 6) }
+func TestSample_2of5(t *testing.T)  { doTest(t, 2, 5) }
+func TestSample_3of7(t *testing.T)  { doTest(t, 3, 7) }
+func TestSample_9of10(t *testing.T) { doTest(t, 9, 10) }
+func TestSample_5of5(t *testing.T)  { doTest(t, 5, 5) }
+
+func TestSampleWithSeed(t *testing.T) {
+	out, err := stream.Contents(
+		stream.Numbers(1, 100),
+		stream.SampleWithSeed(5, 7),
+		stream.Sort().Num(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"12", "21", "72", "86", "99"}; !slices.Equal(out, want) {
+		t.Errorf("got %q; expected %q", out, want)
+	}
+}
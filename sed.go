@@ -0,0 +1,247 @@
+package stream
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SedFilter is a Filter that edits items using a small subset of the
+// sed language.
+type SedFilter struct {
+	cmds  []sedCommand
+	quiet bool
+	err   error
+}
+
+// sedCommand is a single command of a sed script.
+type sedCommand struct {
+	addr   *regexp.Regexp // Optional address
+	op     byte           // 's', 'd', or 'p'
+	re     *regexp.Regexp // Pattern for 's'
+	repl   string         // Replacement for 's', in regexp.Expand syntax
+	global bool           // Replace all matches for 's'
+}
+
+// Sed returns a filter that applies script to every item, like sed
+// applies a script to every line. Commands are separated by ";" or
+// newlines. The supported commands are
+//
+//	s/re/replacement/flags   replace the first match of re
+//	/re/d                    delete items that match re
+//	/re/p                    print items that match re
+//
+// An s command may also be preceded by a /re/ address, and d and p
+// may be used without an address. The s command accepts the flags g
+// (replace all matches) and i (ignore case), and any character may be
+// used instead of "/" after the s. In replacements, & stands for the
+// match and \1 to \9 for submatches. Regular expressions use the
+// syntax of the regexp package. E.g.,
+//
+//	stream.Sed(`/^#/d; s/[[:space:]]+$//; s/colou?r/hue/g`)
+//
+// As with sed, items are printed after the script runs unless they
+// were deleted; see Quiet.
+func Sed(script string) *SedFilter {
+	s := &SedFilter{}
+	s.cmds, s.err = parseSed(script)
+	if s.err != nil {
+		s.err = fmt.Errorf("stream.Sed: %v", s.err)
+	}
+	return s
+}
+
+// Quiet adjusts s so that items are only printed by explicit p
+// commands (like "sed -n").
+func (s *SedFilter) Quiet() *SedFilter {
+	s.quiet = true
+	return s
+}
+
+// RunFilter applies the script to every item. It implements the
+// Filter interface.
+func (s *SedFilter) RunFilter(arg Arg) error {
+	if s.err != nil {
+		return s.err
+	}
+	for item := range arg.In {
+		deleted := false
+		for _, c := range s.cmds {
+			if c.addr != nil && !c.addr.MatchString(item) {
+				continue
+			}
+			switch c.op {
+			case 's':
+				item = c.substitute(item)
+			case 'p':
+				arg.Out <- item
+			case 'd':
+				deleted = true
+			}
+			if deleted {
+				break
+			}
+		}
+		if !deleted && !s.quiet {
+			arg.Out <- item
+		}
+	}
+	return nil
+}
+
+// substitute applies an s command to item.
+func (c *sedCommand) substitute(item string) string {
+	if c.global {
+		return c.re.ReplaceAllString(item, c.repl)
+	}
+	m := c.re.FindStringSubmatchIndex(item)
+	if m == nil {
+		return item
+	}
+	var b []byte
+	b = append(b, item[:m[0]]...)
+	b = c.re.ExpandString(b, c.repl, item, m)
+	b = append(b, item[m[1]:]...)
+	return string(b)
+}
+
+// parseSed parses a sed script.
+func parseSed(script string) ([]sedCommand, error) {
+	var cmds []sedCommand
+	p := sedParser{s: script}
+	for {
+		p.skip(" \t\n;")
+		if p.eof() {
+			return cmds, nil
+		}
+		var c sedCommand
+		if p.peek() == '/' {
+			p.next()
+			re, err := p.regexp('/')
+			if err != nil {
+				return nil, err
+			}
+			c.addr = re
+			p.skip(" \t")
+		}
+		if p.eof() {
+			return nil, fmt.Errorf("missing command after address")
+		}
+		c.op = p.next()
+		switch c.op {
+		case 'd', 'p':
+		case 's':
+			if p.eof() {
+				return nil, fmt.Errorf("unterminated s command")
+			}
+			delim := p.next()
+			pattern, err := p.until(delim)
+			if err != nil {
+				return nil, err
+			}
+			repl, err := p.until(delim)
+			if err != nil {
+				return nil, err
+			}
+			flags := ""
+			for !p.eof() && strings.IndexByte("gi", p.peek()) >= 0 {
+				flags += string(p.next())
+			}
+			c.global = strings.Contains(flags, "g")
+			if strings.Contains(flags, "i") {
+				pattern = "(?i)" + pattern
+			}
+			if c.re, err = regexp.Compile(pattern); err != nil {
+				return nil, err
+			}
+			c.repl = sedReplacement(repl)
+		default:
+			return nil, fmt.Errorf("unsupported command %q", c.op)
+		}
+		p.skip(" \t")
+		if !p.eof() && p.peek() != ';' && p.peek() != '\n' {
+			return nil, fmt.Errorf("unexpected %q after %c command", p.s[p.pos:], c.op)
+		}
+		cmds = append(cmds, c)
+	}
+}
+
+// sedReplacement converts a sed replacement to regexp.Expand syntax.
+func sedReplacement(repl string) string {
+	var b strings.Builder
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '\\' && i+1 < len(repl) && repl[i+1] >= '0' && repl[i+1] <= '9':
+			fmt.Fprintf(&b, "${%c}", repl[i+1])
+			i++
+		case c == '\\' && i+1 < len(repl):
+			i++
+			if repl[i] == 'n' {
+				b.WriteByte('\n')
+			} else if repl[i] == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(repl[i])
+			}
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sedParser tokenizes a sed script.
+type sedParser struct {
+	s   string
+	pos int
+}
+
+func (p *sedParser) eof() bool  { return p.pos >= len(p.s) }
+func (p *sedParser) peek() byte { return p.s[p.pos] }
+
+func (p *sedParser) next() byte {
+	c := p.s[p.pos]
+	p.pos++
+	return c
+}
+
+func (p *sedParser) skip(chars string) {
+	for !p.eof() && strings.IndexByte(chars, p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// until returns the text up to the next unescaped delim and skips
+// the delimiter. An escaped delimiter is replaced by the delimiter.
+func (p *sedParser) until(delim byte) (string, error) {
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch {
+		case c == delim:
+			return b.String(), nil
+		case c == '\\' && !p.eof() && p.peek() == delim:
+			b.WriteByte(p.next())
+		case c == '\\' && !p.eof():
+			b.WriteByte(c)
+			b.WriteByte(p.next())
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("missing %q in %q", delim, p.s)
+}
+
+// regexp parses a regular expression terminated by delim.
+func (p *sedParser) regexp(delim byte) (*regexp.Regexp, error) {
+	pattern, err := p.until(delim)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(pattern)
+}
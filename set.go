@@ -0,0 +1,51 @@
+package stream
+
+// InSet returns a filter that yields every input item that occurs in
+// the output of ref. ref is executed to completion, and its output is
+// held in a hash set (see MemoryBudget), before any input is read.
+// Use Items or ItemsFromSlice to compare against a list of items, or
+// Cat to compare against the lines of a file. E.g.,
+//
+//	stream.InSet(stream.Cat("include.txt"))
+func InSet(ref Filter) Filter {
+	return setFilter(ref, true)
+}
+
+// NotInSet returns a filter that yields every input item that does
+// not occur in the output of ref. E.g., the following removes every
+// item listed in exclude.txt:
+//
+//	stream.NotInSet(stream.Cat("exclude.txt"))
+func NotInSet(ref Filter) Filter {
+	return setFilter(ref, false)
+}
+
+func setFilter(ref Filter, want bool) Filter {
+	return FilterFunc(func(arg Arg) error {
+		set := map[string]bool{}
+		var reserved int64
+		defer func() { arg.Release(reserved) }()
+		var rerr error
+		err := forEach(arg.env, ref, func(s string) {
+			if rerr != nil || set[s] {
+				return
+			}
+			if rerr = arg.Reserve(itemSize(s)); rerr == nil {
+				reserved += itemSize(s)
+				set[s] = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if rerr != nil {
+			return rerr
+		}
+		for s := range arg.In {
+			if set[s] == want {
+				arg.Out <- s
+			}
+		}
+		return nil
+	})
+}
@@ -1,9 +1,15 @@
 package stream
 
 import (
+	"cmp"
+	"math"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 // SortFilter is a Filter that sorts its input items by a sequence of
@@ -11,7 +17,12 @@ import (
 // (this always happens if no sort keys are specified), the items
 // are compared lexicographically.
 type SortFilter struct {
-	cmp []sortComparer
+	keys     []sortKey
+	tmpDir   string
+	memLimit int64 // Spill sorted runs to disk beyond this; 0 means never
+	parallel int   // Number of goroutines used for sorting
+	delim    rune  // Column separator; 0 means white space
+	unique   bool
 }
 
 // Sort returns a filter that sorts its input items. By default, the
@@ -21,9 +32,25 @@ func Sort() *SortFilter {
 	return &SortFilter{}
 }
 
-// sortComparer compares a and b and returns -1 if a occurs before b,
-// +1 if a occurs after b, 0 otherwise.
-type sortComparer func(a, b string) int
+// sortKey is a sort key. To avoid repeating work in every
+// comparison, extract is called once per item before sorting to
+// compute the key value of the item, and compare compares two key
+// values and returns -1 if a occurs before b, +1 if a occurs after b,
+// 0 otherwise.
+type sortKey struct {
+	extract func(item string) keyValue
+	compare func(a, b *keyValue) int
+}
+
+// keyValue holds the part of an item that is compared by a sortKey.
+// Which fields are used depends on the sortKey.
+type keyValue struct {
+	missing int     // -1 if the item does not have the column, else 0
+	str     string  // Text of the column
+	num     float64 // Numeric value of the column
+	bad     bool    // Column could not be parsed
+	time    time.Time
+}
 
 // column(s, n) returns 0,x where x is the nth column (1-based) in s,
 // or -1,"" if s does not have n columns.  A zero column number is
@@ -54,24 +81,67 @@ func column(s string, n int) (int, string) {
 	return -1, ""
 }
 
+// delimitedColumn is like column, but columns are separated by every
+// occurrence of delim instead of by white space, so columns may be
+// empty. If delim is zero, it behaves exactly like column.
+func delimitedColumn(s string, n int, delim rune) (int, string) {
+	if delim == 0 || n == 0 {
+		return column(s, n)
+	}
+	for i := 1; ; i++ {
+		j := strings.IndexRune(s, delim)
+		switch {
+		case i == n && j < 0:
+			return 0, s
+		case i == n:
+			return 0, s[:j]
+		case j < 0:
+			return -1, ""
+		}
+		s = s[j+utf8.RuneLen(delim):]
+	}
+}
+
+// Delimiter adjusts s so that columns are separated by every
+// occurrence of delim instead of by runs of white space, e.g., to
+// sort /etc/passwd by user id:
+//
+//	stream.Sort().Delimiter(':').Num(3)
+func (s *SortFilter) Delimiter(delim rune) *SortFilter {
+	s.delim = delim
+	return s
+}
+
+// column returns column n of item, taking the delimiter of s into
+// account (see column).
+func (s *SortFilter) column(item string, n int) (int, string) {
+	return delimitedColumn(item, n, s.delim)
+}
+
 // Text sets the next sort key to sort by column n in lexicographic
 // order. Column 0 means the entire string. Items that do not have
 // column n sort to the front.
 func (s *SortFilter) Text(n int) *SortFilter {
-	s.add(func(a, b string) int {
-		a1, a2 := column(a, n)
-		b1, b2 := column(b, n)
-		switch {
-		case a1 < b1:
-			return -1
-		case a1 > b1:
-			return +1
-		case a2 < b2:
-			return -1
-		case a2 > b2:
-			return +1
-		}
-		return 0
+	return s.columnKey(n, func(a, b *keyValue) int {
+		return strings.Compare(a.str, b.str)
+	})
+}
+
+// columnKey sets the next sort key to sort by column n using compare
+// for items that have column n. Items that do not have column n sort
+// to the front.
+func (s *SortFilter) columnKey(n int, compare func(a, b *keyValue) int) *SortFilter {
+	s.add(sortKey{
+		extract: func(item string) keyValue {
+			missing, c := s.column(item, n)
+			return keyValue{missing: missing, str: c}
+		},
+		compare: func(a, b *keyValue) int {
+			if a.missing != b.missing {
+				return a.missing - b.missing
+			}
+			return compare(a, b)
+		},
 	})
 	return s
 }
@@ -88,38 +158,42 @@ func (s *SortFilter) TextDecreasing(n int) *SortFilter {
 // column n sort to the front.  Items whose column n is not a number
 // sort to the end.
 func (s *SortFilter) Num(n int) *SortFilter {
-	s.add(func(a, b string) int {
-		a1, a2 := column(a, n)
-		b1, b2 := column(b, n)
-		switch {
-		case a1 < b1:
-			return -1
-		case a1 > b1:
-			return +1
-		}
-
-		// Convert columns from strings to numbers.
-		a3, a4 := strconv.ParseFloat(a2, 64)
-		b3, b4 := strconv.ParseFloat(b2, 64)
+	return s.numeric(n, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+}
 
-		if a4 != b4 {
-			// Errors sort after numbers.
-			if a4 != nil { // a had a parse error, b did not
-				return +1
-			}
-			// b had a parse error, a did not
-			return -1
-		}
+// numeric sets the next sort key to sort by the numbers that parse
+// extracts from column n.
+func (s *SortFilter) numeric(n int, parse func(string) (float64, error)) *SortFilter {
+	s.add(sortKey{
+		extract: func(item string) keyValue {
+			missing, c := s.column(item, n)
+			v, err := parse(c)
+			return keyValue{missing: missing, num: v, bad: err != nil}
+		},
+		compare: compareNumbers,
+	})
+	return s
+}
 
-		switch {
-		case a3 < b3:
-			return -1
-		case a3 > b3:
+// compareNumbers compares the numeric key values a and b.
+func compareNumbers(a, b *keyValue) int {
+	switch {
+	case a.missing != b.missing:
+		return a.missing - b.missing
+	case a.bad != b.bad:
+		// Errors sort after numbers.
+		if a.bad {
 			return +1
 		}
-		return 0
-	})
-	return s
+		return -1
+	case a.num < b.num:
+		return -1
+	case a.num > b.num:
+		return +1
+	}
+	return 0
 }
 
 // NumDecreasing sets the next sort key to sort by column n in reverse
@@ -130,60 +204,411 @@ func (s *SortFilter) NumDecreasing(n int) *SortFilter {
 	return s.Num(n).flipLast()
 }
 
-// By adds a sort key to sort by the output of the specified less function.
-func (s *SortFilter) By(less func(a, b string) bool) *SortFilter {
-	s.add(func(a, b string) int {
-		if less(a, b) {
-			return -1
+// HumanSize sets the next sort key to sort by column n in the order
+// of the sizes it holds, which may have a suffix like "K", "M", or "G"
+// denoting a power of 1024 (like "sort -h"), as in the output of "du
+// -h" or "ls -lh". Column 0 means the entire string. Items that do
+// not have column n sort to the front.  Items whose column n is not a
+// size sort to the end.
+func (s *SortFilter) HumanSize(n int) *SortFilter {
+	return s.numeric(n, parseHumanSize)
+}
+
+// HumanSizeDecreasing sets the next sort key to sort by column n in
+// the reverse order of the sizes it holds (see HumanSize). Column 0
+// means the entire string. Items that do not have column n sort to
+// the end.  Items whose column n is not a size sort to the front.
+func (s *SortFilter) HumanSizeDecreasing(n int) *SortFilter {
+	return s.HumanSize(n).flipLast()
+}
+
+// parseHumanSize converts a size like "1.5K" or "23M" to a number.
+func parseHumanSize(s string) (float64, error) {
+	scale := 1.0
+	if s != "" {
+		if i := strings.IndexByte("KMGTPE", s[len(s)-1]&^0x20); i >= 0 {
+			s = s[:len(s)-1]
+			scale = math.Pow(1024, float64(i+1))
 		}
-		if less(b, a) {
-			return +1
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * scale, err
+}
+
+// Version sets the next sort key to sort by column n in the order of
+// the version numbers it holds (like "sort -V"): runs of digits are
+// compared numerically, so "1.2.10" sorts after "1.2.9", and a
+// version followed by a prerelease suffix that starts with "-" or "~"
+// sorts before the version itself, so "1.0-rc1" sorts before "1.0".
+// Column 0 means the entire string. Items that do not have column n
+// sort to the front.
+func (s *SortFilter) Version(n int) *SortFilter {
+	return s.columnKey(n, func(a, b *keyValue) int {
+		return compareVersions(a.str, b.str)
+	})
+}
+
+// VersionDecreasing sets the next sort key to sort by column n in
+// the reverse order of the version numbers it holds (see Version).
+// Column 0 means the entire string. Items that do not have column n
+// sort to the end.
+func (s *SortFilter) VersionDecreasing(n int) *SortFilter {
+	return s.Version(n).flipLast()
+}
+
+// compareVersions compares the version numbers a and b and returns
+// -1, 0, or +1 (see SortFilter.Version).
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		var x, y string
+		x, a = versionToken(a)
+		y, b = versionToken(b)
+		if isDigit(x[0]) && isDigit(y[0]) {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				return cmp.Compare(len(x), len(y))
+			}
 		}
+		if r := strings.Compare(x, y); r != 0 {
+			return r
+		}
+	}
+	// A prerelease suffix sorts before the end of a version.
+	prerelease := func(s string) bool { return s != "" && (s[0] == '-' || s[0] == '~') }
+	switch {
+	case a == b:
 		return 0
+	case a == "":
+		if prerelease(b) {
+			return +1
+		}
+		return -1
+	default:
+		if prerelease(a) {
+			return -1
+		}
+		return +1
+	}
+}
+
+// versionToken splits the leading run of digits or of non-digits off
+// the non-empty string s.
+func versionToken(s string) (token, rest string) {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// Month sets the next sort key to sort by column n in calendar order
+// of the month names it holds (like "sort -M"). Only the first three
+// letters of a column are significant, and case is ignored, so "jan",
+// "Jan", and "January" are equivalent. Column 0 means the entire
+// string. Items that do not have column n, or whose column n is not
+// a month name, sort to the front.
+func (s *SortFilter) Month(n int) *SortFilter {
+	return s.numeric(n, func(s string) (float64, error) {
+		if len(s) >= 3 {
+			if i := strings.Index(months, strings.ToLower(s[:3])); i >= 0 && i%3 == 0 {
+				return float64(i/3 + 1), nil
+			}
+		}
+		return 0, nil
+	})
+}
+
+const months = "janfebmaraprmayjunjulaugsepoctnovdec"
+
+// Time sets the next sort key to sort by column n in chronological
+// order of the times it holds, which are parsed using layout (see
+// time.Parse). Column 0 means the entire string. Items that do not
+// have column n sort to the front. Items whose column n cannot be
+// parsed sort to the end.
+func (s *SortFilter) Time(n int, layout string) *SortFilter {
+	s.add(sortKey{
+		extract: func(item string) keyValue {
+			missing, c := s.column(item, n)
+			t, err := time.Parse(layout, c)
+			return keyValue{missing: missing, time: t, bad: err != nil}
+		},
+		compare: func(a, b *keyValue) int {
+			switch {
+			case a.missing != b.missing:
+				return a.missing - b.missing
+			case a.bad && b.bad:
+				return 0
+			case a.bad:
+				return +1
+			case b.bad:
+				return -1
+			}
+			return a.time.Compare(b.time)
+		},
+	})
+	return s
+}
+
+// By adds a sort key to sort by the output of the specified less function.
+func (s *SortFilter) By(less func(a, b string) bool) *SortFilter {
+	s.add(sortKey{
+		extract: func(item string) keyValue { return keyValue{str: item} },
+		compare: func(a, b *keyValue) int {
+			if less(a.str, b.str) {
+				return -1
+			}
+			if less(b.str, a.str) {
+				return +1
+			}
+			return 0
+		},
 	})
 	return s
 }
 
-func (s *SortFilter) add(cmp sortComparer) {
-	s.cmp = append(s.cmp, cmp)
+// ByKey adds a sort key to sort by the output of key for every item,
+// in numeric order if numeric is true, else in lexicographic order.
+// The items themselves are yielded unchanged. key is called once per
+// item. In numeric order, items whose key is not a number sort to the
+// end. E.g., the following sorts paths by their base names:
+//
+//	stream.Sort().ByKey(filepath.Base, false)
+func (s *SortFilter) ByKey(key func(string) string, numeric bool) *SortFilter {
+	if !numeric {
+		s.add(sortKey{
+			extract: func(item string) keyValue { return keyValue{str: key(item)} },
+			compare: func(a, b *keyValue) int { return strings.Compare(a.str, b.str) },
+		})
+		return s
+	}
+	s.add(sortKey{
+		extract: func(item string) keyValue {
+			v, err := strconv.ParseFloat(key(item), 64)
+			return keyValue{num: v, bad: err != nil}
+		},
+		compare: compareNumbers,
+	})
+	return s
+}
+
+func (s *SortFilter) add(k sortKey) {
+	s.keys = append(s.keys, k)
 }
 
 // flipLast reverses the comparison order for the last sort key.
 func (s *SortFilter) flipLast() *SortFilter {
-	last := s.cmp[len(s.cmp)-1]
-	s.cmp[len(s.cmp)-1] = func(a, b string) int { return last(b, a) }
+	last := s.keys[len(s.keys)-1].compare
+	s.keys[len(s.keys)-1].compare = func(a, b *keyValue) int { return last(b, a) }
 	return s
 }
 
+// sortRecord is an item along with the values of all sort keys for
+// it.
+type sortRecord struct {
+	item string
+	keys []keyValue
+}
+
+// extract fills keys with the key values of item for all sort keys of
+// s.
+func (s *SortFilter) extract(item string, keys []keyValue) {
+	for i, k := range s.keys {
+		keys[i] = k.extract(item)
+	}
+}
+
+// fillRecords fills recs with the records for items, including
+// their key values.
+func (s *SortFilter) fillRecords(recs []sortRecord, items []string) {
+	values := make([]keyValue, len(items)*len(s.keys))
+	for i, item := range items {
+		keys := values[i*len(s.keys) : (i+1)*len(s.keys)]
+		s.extract(item, keys)
+		recs[i] = sortRecord{item, keys}
+	}
+}
+
 type sortState struct {
-	cmp  []sortComparer
-	data []string
+	keys []sortKey
+	data []sortRecord
 }
 
 func (s sortState) Len() int      { return len(s.data) }
 func (s sortState) Swap(i, j int) { s.data[i], s.data[j] = s.data[j], s.data[i] }
 func (s sortState) Less(i, j int) bool {
-	a := s.data[i]
-	b := s.data[j]
-	for _, cmp := range s.cmp {
-		r := cmp(a, b)
-		if r != 0 {
-			return r < 0
+	return compareRecords(s.keys, &s.data[i], &s.data[j]) < 0
+}
+
+// compareRecords compares a and b according to the sort keys keys,
+// and lexicographically if they are equal according to all keys.
+func compareRecords(keys []sortKey, a, b *sortRecord) int {
+	for i, k := range keys {
+		if r := k.compare(&a.keys[i], &b.keys[i]); r != 0 {
+			return r
 		}
 	}
-	return a < b
+	return strings.Compare(a.item, b.item)
 }
 
 // RunFilter sorts items by the specified sorting keys. It implements
 // the Filter interface.
 func (s *SortFilter) RunFilter(arg Arg) error {
-	state := sortState{s.cmp, nil}
+	if s.memLimit > 0 {
+		return s.runExternal(arg)
+	}
+	var data []string
+	var reserved int64
+	defer func() { arg.Release(reserved) }()
 	for item := range arg.In {
-		state.data = append(state.data, item)
+		if err := arg.Reserve(itemSize(item)); err != nil {
+			return err
+		}
+		reserved += itemSize(item)
+		data = append(data, item)
 	}
-	sort.Sort(state)
-	for _, item := range state.data {
-		arg.Out <- item
+	wanted := s.uniqueCheck()
+	for _, item := range s.sortItems(data) {
+		if wanted(item) {
+			arg.Out <- item
+		}
 	}
 	return nil
 }
+
+// Unique adjusts s so that only the first of every run of items that
+// compare equal by all sort keys is yielded (like "sort -u"). If no
+// sort keys are specified, only identical items compare equal.
+func (s *SortFilter) Unique() *SortFilter {
+	s.unique = true
+	return s
+}
+
+// uniqueCheck returns a function that is called for every sorted
+// item and reports whether it should be yielded.
+func (s *SortFilter) uniqueCheck() func(item string) bool {
+	if !s.unique {
+		return func(string) bool { return true }
+	}
+	prev := sortRecord{keys: make([]keyValue, len(s.keys))}
+	cur := sortRecord{keys: make([]keyValue, len(s.keys))}
+	first := true
+	return func(item string) bool {
+		cur.item = item
+		s.extract(item, cur.keys)
+		if !first && s.equalKeys(&prev, &cur) {
+			return false
+		}
+		first = false
+		prev, cur = cur, prev
+		return true
+	}
+}
+
+// equalKeys reports whether a and b compare equal by all sort keys of
+// s, or are identical if s has no sort keys.
+func (s *SortFilter) equalKeys(a, b *sortRecord) bool {
+	if len(s.keys) == 0 {
+		return a.item == b.item
+	}
+	for i, k := range s.keys {
+		if k.compare(&a.keys[i], &b.keys[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Parallel adjusts s so that large inputs are split into n chunks
+// that are sorted concurrently and then merged. This speeds up
+// sorting millions of items on machines with several CPUs.
+func (s *SortFilter) Parallel(n int) *SortFilter {
+	s.parallel = n
+	return s
+}
+
+// minParallelChunk is the smallest number of items that is sorted in
+// a separate goroutine.
+const minParallelChunk = 4096
+
+// sortItems sorts data according to the sort keys of s. The sorted
+// items are stored in data, which is returned for convenience.
+func (s *SortFilter) sortItems(data []string) []string {
+	n := max(1, min(s.parallel, len(data)/minParallelChunk))
+	if n == 1 && len(s.keys) == 0 {
+		sort.Strings(data)
+		return data
+	}
+	recs := make([]sortRecord, len(data))
+	chunks := make([][]sortRecord, n)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		lo, hi := i*len(data)/n, (i+1)*len(data)/n
+		chunks[i] = recs[lo:hi]
+		sortChunk := func() {
+			s.fillRecords(chunks[i], data[lo:hi])
+			sort.Sort(sortState{s.keys, chunks[i]})
+		}
+		if n == 1 {
+			sortChunk()
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sortChunk()
+		}()
+	}
+	wg.Wait()
+
+	// Merge pairs of adjacent chunks until a single one is left.
+	var buf []sortRecord
+	if n > 1 {
+		buf = make([]sortRecord, len(data))
+	}
+	for len(chunks) > 1 {
+		merged := make([][]sortRecord, 0, (len(chunks)+1)/2)
+		offset := 0
+		for i := 0; i < len(chunks); i += 2 {
+			if i+1 == len(chunks) {
+				dst := buf[offset : offset+len(chunks[i])]
+				copy(dst, chunks[i])
+				merged = append(merged, dst)
+				break
+			}
+			a, b := chunks[i], chunks[i+1]
+			dst := buf[offset : offset+len(a)+len(b)]
+			offset += len(dst)
+			merged = append(merged, dst)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mergeSorted(s.keys, dst, a, b)
+			}()
+		}
+		wg.Wait()
+		chunks = merged
+		recs, buf = buf, recs
+	}
+	for i, r := range chunks[0] {
+		data[i] = r.item
+	}
+	return data
+}
+
+// mergeSorted merges the sorted slices a and b into dst, which must
+// have room for both.
+func mergeSorted(keys []sortKey, dst, a, b []sortRecord) {
+	i, j := 0, 0
+	for k := range dst {
+		if j == len(b) || (i < len(a) && compareRecords(keys, &b[j], &a[i]) >= 0) {
+			dst[k] = a[i]
+			i++
+		} else {
+			dst[k] = b[j]
+			j++
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"cmp"
+	"iter"
+	"maps"
+	"slices"
+)
+
+// ItemsFromSlice emits the elements of items. Unlike Items(items...),
+// the slice is read when the filter runs, not when it is created.
+func ItemsFromSlice(items []string) Filter {
+	return &builtinFilter{
+		name: "ItemsFromSlice",
+		items: func(arg Arg) error {
+			for _, s := range items {
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		lazy: func(iter.Seq[string]) iter.Seq[string] {
+			return slices.Values(items)
+		},
+	}
+}
+
+// ItemsFromChannel emits every item received from ch until ch is
+// closed. If the context of the pipeline (see Arg.Context) is done
+// first, the filter returns the context's error.
+func ItemsFromChannel(ch <-chan string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		done, stop := arg.Context().Done(), arg.outStop.done()
+		for {
+			select {
+			case s, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			case <-done:
+				return arg.Context().Err()
+			case <-stop:
+				return ErrStopped
+			}
+		}
+	})
+}
+
+// ItemsFromSeq emits every item produced by seq.
+func ItemsFromSeq(seq iter.Seq[string]) Filter {
+	return &builtinFilter{
+		name: "ItemsFromSeq",
+		items: func(arg Arg) error {
+			for s := range seq {
+				if err := arg.Send(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		lazy: func(iter.Seq[string]) iter.Seq[string] { return seq },
+	}
+}
+
+// KeysOf emits the keys of m in sorted order.
+func KeysOf[V any](m map[string]V) Filter {
+	return FilterFunc(func(arg Arg) error {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if err := arg.Send(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ValuesOf emits the values of m in the order of their sorted keys.
+func ValuesOf[K cmp.Ordered](m map[K]string) Filter {
+	return FilterFunc(func(arg Arg) error {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			if err := arg.Send(m[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Generate emits the items passed to emit by fn. fn may run for as
+// long as it likes, e.g., to produce an unbounded sequence or to poll
+// for new data, but it should return once emit returns false, which
+// happens when the pipeline is no longer interested in more items,
+// either because the rest of the pipeline wants no more items (see
+// ErrStopped) or because its context (see Arg.Context) is done. In
+// the latter case, the filter returns the context's error.
+func Generate(fn func(emit func(string) bool)) Filter {
+	return FilterFunc(func(arg Arg) error {
+		fn(func(s string) bool {
+			return arg.Send(s) == nil
+		})
+		return arg.Context().Err()
+	})
+}
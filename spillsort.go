@@ -0,0 +1,178 @@
+package stream
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// External adjusts s so that at most memLimit bytes of items are held
+// in memory (less if the memory budget of the pipeline is exhausted;
+// see MemoryBudget). Whenever the limit is reached, the items held in
+// memory are sorted and written to a temporary file in tmpDir (or in
+// the default directory for temporary files if tmpDir is empty), and
+// the sorted files are merged once the input is exhausted. This
+// allows sorting inputs that do not fit in memory. The temporary
+// files are removed before the filter finishes.
+func (s *SortFilter) External(tmpDir string, memLimit int64) *SortFilter {
+	s.tmpDir, s.memLimit = tmpDir, memLimit
+	return s
+}
+
+// runExternal sorts the input items using temporary files for sorted
+// runs that do not fit in memory.
+func (s *SortFilter) runExternal(arg Arg) error {
+	var data []string
+	var runs []*os.File
+	defer func() {
+		for _, f := range runs {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	var size int64
+	defer func() { arg.Release(size) }()
+	flush := func() error {
+		s.sortItems(data)
+		f, err := os.CreateTemp(s.tmpDir, "stream-sort")
+		if err != nil {
+			return err
+		}
+		runs = append(runs, f)
+		w := bufio.NewWriter(f)
+		for _, item := range data {
+			// Items are preceded by their length since they may
+			// contain any byte.
+			if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(item)))); err != nil {
+				return err
+			}
+			if _, err := w.WriteString(item); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		arg.Release(size)
+		data, size = nil, 0
+		return nil
+	}
+	for item := range arg.In {
+		n := itemSize(item)
+		if len(data) > 0 && size+n > s.memLimit {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if err := arg.Reserve(n); err != nil {
+			if len(data) == 0 {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := arg.Reserve(n); err != nil {
+				return err
+			}
+		}
+		size += n
+		data = append(data, item)
+	}
+	if len(runs) == 0 {
+		wanted := s.uniqueCheck()
+		for _, item := range s.sortItems(data) {
+			if wanted(item) {
+				arg.Out <- item
+			}
+		}
+		return nil
+	}
+	if len(data) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return s.mergeRuns(arg, runs)
+}
+
+// mergeRuns emits the items of the sorted files runs in sorted order.
+func (s *SortFilter) mergeRuns(arg Arg, runs []*os.File) error {
+	h := &runHeap{keys: s.keys}
+	for _, f := range runs {
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+		r := &sortRun{s: s, rd: bufio.NewReader(f)}
+		r.rec.keys = make([]keyValue, len(s.keys))
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.runs = append(h.runs, r)
+		}
+	}
+	heap.Init(h)
+	wanted := s.uniqueCheck()
+	for len(h.runs) > 0 {
+		r := h.runs[0]
+		if wanted(r.rec.item) {
+			arg.Out <- r.rec.item
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// sortRun reads the items of a sorted temporary file.
+type sortRun struct {
+	s   *SortFilter
+	rd  *bufio.Reader
+	rec sortRecord // Current item
+}
+
+// next reads the next item into r.rec, and reports whether there
+// was one.
+func (r *sortRun) next() (bool, error) {
+	n, err := binary.ReadUvarint(r.rd)
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return false, err
+	}
+	r.rec.item = string(buf)
+	r.s.extract(r.rec.item, r.rec.keys)
+	return true, nil
+}
+
+// runHeap orders sorted runs by their current items.
+type runHeap struct {
+	keys []sortKey
+	runs []*sortRun
+}
+
+func (h *runHeap) Len() int { return len(h.runs) }
+func (h *runHeap) Less(i, j int) bool {
+	return compareRecords(h.keys, &h.runs[i].rec, &h.runs[j].rec) < 0
+}
+func (h *runHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *runHeap) Push(x any)    { h.runs = append(h.runs, x.(*sortRun)) }
+func (h *runHeap) Pop() any {
+	r := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return r
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stat returns a filter that treats each input item as a filesystem
+// path and yields the result of expanding format with metadata for
+// that path. Symbolic links are not followed. The following
+// directives are recognized in format:
+//
+//	%p	the path
+//	%s	the size in bytes
+//	%m	the mode, in the format used by os.FileMode.String
+//	%t	the modification time, in RFC 3339 format
+//	%T	the modification time, in seconds since the Unix epoch
+//	%u	the name (or numeric id, if unknown) of the owner
+//	%g	the name (or numeric id, if unknown) of the group
+//	%%	a literal %
+//
+// For example, Stat("%s %p") yields the size of every path followed
+// by the path, suitable for sorting with Sort().Num(1).
+func Stat(format string) Filter {
+	parts, err := parseStatFormat(format)
+	if err != nil {
+		return FilterFunc(func(Arg) error { return err })
+	}
+	return FilterFunc(func(arg Arg) error {
+		for s := range arg.In {
+			info, err := os.Lstat(s)
+			if err != nil {
+				if err := arg.Fail(s, err); err != nil {
+					return err
+				}
+				continue
+			}
+			var b strings.Builder
+			for _, p := range parts {
+				b.WriteString(p(s, info))
+			}
+			arg.Out <- b.String()
+		}
+		return nil
+	})
+}
+
+// statPart produces one piece of the output of a Stat filter.
+type statPart func(path string, info os.FileInfo) string
+
+func parseStatFormat(format string) ([]statPart, error) {
+	var parts []statPart
+	literal := func(s string) statPart {
+		return func(string, os.FileInfo) string { return s }
+	}
+	start := 0 // Start of pending literal text
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 >= len(format) {
+			return nil, fmt.Errorf("stream.Stat: format %q ends with %%", format)
+		}
+		if i > start {
+			parts = append(parts, literal(format[start:i]))
+		}
+		var p statPart
+		switch format[i+1] {
+		case 'p':
+			p = func(path string, _ os.FileInfo) string { return path }
+		case 's':
+			p = func(_ string, info os.FileInfo) string {
+				return strconv.FormatInt(info.Size(), 10)
+			}
+		case 'm':
+			p = func(_ string, info os.FileInfo) string {
+				return info.Mode().String()
+			}
+		case 't':
+			p = func(_ string, info os.FileInfo) string {
+				return info.ModTime().Format(time.RFC3339)
+			}
+		case 'T':
+			p = func(_ string, info os.FileInfo) string {
+				return strconv.FormatInt(info.ModTime().Unix(), 10)
+			}
+		case 'u':
+			p = func(_ string, info os.FileInfo) string { return fileOwner(info) }
+		case 'g':
+			p = func(_ string, info os.FileInfo) string { return fileGroup(info) }
+		case '%':
+			p = literal("%")
+		default:
+			return nil, fmt.Errorf("stream.Stat: unknown directive %%%c in format %q",
+				format[i+1], format)
+		}
+		parts = append(parts, p)
+		i++
+		start = i + 1
+	}
+	if start < len(format) {
+		parts = append(parts, literal(format[start:]))
+	}
+	return parts, nil
+}
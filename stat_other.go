@@ -0,0 +1,13 @@
+//go:build !unix
+
+package stream
+
+import "os"
+
+// fileOwner returns "?" since file ownership is not available on this
+// platform.
+func fileOwner(info os.FileInfo) string { return "?" }
+
+// fileGroup returns "?" since file ownership is not available on this
+// platform.
+func fileGroup(info os.FileInfo) string { return "?" }
@@ -18,6 +18,9 @@ filter. The output of one filter is fed as input to the next filter.
 stream.Run is just one way to execute filters.  Others are stream.Contents
 (returns the output of the last filter as a []string), and
 stream.ForEach (executes a supplied function for every output item).
+A stream.Runner executes filters in the same ways, but also supplies
+the filters with a context, a logger, and a place to report
+non-fatal errors.
 
 Error handling
 
@@ -32,6 +35,10 @@ non-nil error.
 	)
 	// err will be non-nil
 
+The error identifies the stage of the pipeline that failed (see
+StageError); here it is "stage 2 (Grep): error parsing regexp: ...".
+A filter that panics is reported as failing with a *PanicError.
+
 User defined filters
 
 Each filter takes as input a sequence of strings (read from a channel)
@@ -68,6 +75,12 @@ Note that Repeat returns a FilterFunc, a function type that implements the
 Filter interface. This is a common implementation pattern: many simple filters
 can be expressed as a single function of type FilterFunc.
 
+Filters that run for a long time can use arg.Context() to notice
+that the pipeline has been cancelled (see RunContext), arg.Send() to
+emit items without blocking after cancellation, arg.Logger() to log
+diagnostics, and arg.Report() to report problems that should not
+stop the pipeline.
+
 Tunable Filters
 
 FilterFunc is an appropriate type to use for most filters like Repeat
@@ -82,6 +95,33 @@ extra methods that can be used to control how items are sorted:
 		stream.WriteLines(os.Stdout),
 	)
 
+Typed pipelines
+
+Pipelines can also carry items of other types than strings. A
+StageOf[T, U] reads items of type T and produces items of type U; a
+Filter is just a StageOf[string, string]. Stages are chained with
+Then (or SequenceOf, if all stages have the same type) and executed
+with RunOf, ForEachOf, or ContentsOf. Filters whose type is more
+specific than Filter (e.g., *FindFilter) need a conversion to Filter
+for type inference to work. For example, the following prints the
+total size of all regular files under the current directory:
+
+	var total int64
+	stream.ForEachOf(
+		stream.Then(
+			stream.Filter(stream.Find(".").IfMode(os.FileMode.IsRegular)),
+			stream.MapOf(func(name string) int64 {
+				info, err := os.Stat(name)
+				if err != nil {
+					return 0
+				}
+				return info.Size()
+			}),
+		),
+		func(size int64) { total += size },
+	)
+	fmt.Println(total)
+
 Acknowledgments
 
 The interface of this package is inspired by the http://labix.org/pipe
@@ -90,7 +130,11 @@ needs better.
 */
 package stream
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+)
 
 // filterErrors records errors accumulated during the execution of a filter.
 type filterErrors struct {
@@ -116,22 +160,73 @@ func (e *filterErrors) getError() error {
 
 // Arg contains the data passed to Filter.Run. Arg.In is a channel that
 // produces the input to the filter, and Arg.Out is a channel that
-// receives the output from the filter.
-type Arg struct {
-	In    <-chan string
-	Out   chan<- string
-	dummy bool // To allow later expansion
+// receives the output from the filter. Arg methods provide access to
+// services shared by all filters in a pipeline (see Runner).
+type Arg = ArgOf[string, string]
+
+// ArgOf contains the data passed to StageOf.RunFilter. It is the
+// generalization of Arg to stages whose input items have type T and
+// whose output items have type U.
+type ArgOf[T, U any] struct {
+	In      <-chan T
+	Out     chan<- U
+	env     *runEnv     // Shared pipeline services; nil means defaults
+	inStop  *stopSignal // Raised when the filter wants no more input
+	outStop *stopSignal // Raised when the next filter wants no more input
+}
+
+// ErrStopped is returned by Arg.Send when the rest of the pipeline
+// wants no more items, e.g., because a First filter has seen as many
+// items as it needs or a ForEachWhile callback returned false. A
+// filter that gets ErrStopped should return it (possibly wrapped)
+// promptly; it is not reported as an error of the pipeline.
+var ErrStopped = errors.New("stream: no more items wanted")
+
+// stopSignal tells the filter that produces the items on a channel
+// that they are no longer wanted. A nil *stopSignal is never raised.
+type stopSignal struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newStopSignal() *stopSignal {
+	return &stopSignal{ch: make(chan struct{})}
+}
+
+// raise raises s; it may be called more than once.
+func (s *stopSignal) raise() {
+	if s != nil {
+		s.once.Do(func() { close(s.ch) })
+	}
+}
+
+// done returns a channel that is closed once s is raised.
+func (s *stopSignal) done() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.ch
 }
 
 // The Filter interface represents a process that takes as input a
 // sequence of strings from a channel and produces a sequence on
-// another channel.
-type Filter interface {
+// another channel. Filter is the specialization of StageOf (and
+// FilterOf) to strings.
+type Filter = FilterOf[string]
+
+// FilterOf is a stage whose input and output items have the same type
+// T, so that FilterOf stages can be combined with SequenceOf.
+type FilterOf[T any] = StageOf[T, T]
+
+// The StageOf interface represents a stage of a pipeline that takes as
+// input a sequence of items of type T from a channel and produces a
+// sequence of items of type U on another channel.
+type StageOf[T, U any] interface {
 	// RunFilter reads a sequence of items from Arg.In and produces a
 	// sequence of items on Arg.Out.  RunFilter returns nil on success,
 	// an error otherwise.  RunFilter must *not* close the Arg.Out
 	// channel.
-	RunFilter(Arg) error
+	RunFilter(ArgOf[T, U]) error
 }
 
 // FilterFunc is an adapter type that allows the use of ordinary
@@ -142,64 +237,125 @@ type FilterFunc func(Arg) error
 // RunFilter calls this function. It implements the Filter interface.
 func (f FilterFunc) RunFilter(arg Arg) error { return f(arg) }
 
+// StageFunc is an adapter type that allows the use of ordinary
+// functions as stages. It is the generalization of FilterFunc.
+type StageFunc[T, U any] func(ArgOf[T, U]) error
+
+// RunFilter calls this function. It implements the StageOf interface.
+func (f StageFunc[T, U]) RunFilter(arg ArgOf[T, U]) error { return f(arg) }
+
 const channelBuffer = 1000
 
 // Sequence returns a filter that is the concatenation of all filter arguments.
 // The output of a filter is fed as input to the next filter.
 func Sequence(filters ...Filter) Filter {
+	return SequenceOf(filters...)
+}
+
+// SequenceOf is the generalization of Sequence to items of type T.
+func SequenceOf[T any](filters ...FilterOf[T]) FilterOf[T] {
 	if len(filters) == 1 {
 		return filters[0]
 	}
-	return FilterFunc(func(arg Arg) error {
-		e := &filterErrors{}
-		in := arg.In
-		for _, f := range filters {
-			c := make(chan string, channelBuffer)
-			go runFilter(f, Arg{In: in, Out: c}, e)
-			in = c
-		}
-		for s := range in {
-			arg.Out <- s
+	return &sequence[T]{filters}
+}
+
+// sequence is the filter returned by SequenceOf.
+type sequence[T any] struct {
+	filters []FilterOf[T]
+}
+
+func (q *sequence[T]) RunFilter(arg ArgOf[T, T]) error {
+	filters := q.filters
+	e := &filterErrors{}
+	in := arg.In
+	inStop := arg.inStop
+	for i, f := range filters {
+		c := make(chan T, channelBuffer)
+		outStop := arg.outStop
+		if i < len(filters)-1 {
+			outStop = newStopSignal()
 		}
-		return e.getError()
-	})
+		go runFilter(f, ArgOf[T, T]{In: in, Out: c, env: arg.env, inStop: inStop, outStop: outStop}, e)
+		in, inStop = c, outStop
+	}
+	for s := range in {
+		arg.Out <- s
+	}
+	return e.getError()
 }
 
 // Run executes the sequence of filters and discards all output.
 // It returns either nil, an error if any filter reported an error.
 func Run(filters ...Filter) error {
-	return ForEach(Sequence(filters...), func(s string) {})
+	return defaultRunner.Run(filters...)
 }
 
 // ForEach calls fn(s) for every item s in the output of filter and
 // returns either nil, or any error reported by the execution of the filter.
 func ForEach(filter Filter, fn func(s string)) error {
-	in := make(chan string)
-	close(in)
-	out := make(chan string, channelBuffer)
-	e := &filterErrors{}
-	go runFilter(filter, Arg{In: in, Out: out}, e)
-	for s := range out {
-		fn(s)
-	}
-	return e.getError()
+	return defaultRunner.ForEach(filter, fn)
+}
+
+// ForEachWhile calls fn(s) for every item s in the output of filter
+// until fn returns false. The filters then stop producing items (see
+// ErrStopped). It returns either nil, or any error reported by the
+// execution of the filter.
+func ForEachWhile(filter Filter, fn func(s string) bool) error {
+	return defaultRunner.ForEachWhile(filter, fn)
 }
 
 // Contents returns a slice that contains all items that are
 // the output of filters.
 func Contents(filters ...Filter) ([]string, error) {
-	var result []string
-	err := ForEach(Sequence(filters...), func(s string) {
-		result = append(result, s)
-	})
-	if err != nil {
-		result = nil // Discard results on error
-	}
-	return result, err
+	return defaultRunner.Contents(filters...)
+}
+
+// RunContext is like Run, but the pipeline is cancelled when ctx is
+// done. Filters observe the cancellation via Arg.Context and Arg.Send;
+// the filters that produce items stop early and the pipeline returns
+// an error that wraps ctx.Err().
+func RunContext(ctx context.Context, filters ...Filter) error {
+	return defaultRunner.withContext(ctx).Run(filters...)
 }
 
-func runFilter(f Filter, arg Arg, e *filterErrors) {
-	e.record(f.RunFilter(arg))
+// ForEachContext is like ForEach, but the pipeline is cancelled when
+// ctx is done (see RunContext).
+func ForEachContext(ctx context.Context, filter Filter, fn func(s string)) error {
+	return defaultRunner.withContext(ctx).ForEach(filter, fn)
+}
+
+// ContentsContext is like Contents, but the pipeline is cancelled
+// when ctx is done (see RunContext).
+func ContentsContext(ctx context.Context, filters ...Filter) ([]string, error) {
+	return defaultRunner.withContext(ctx).Contents(filters...)
+}
+
+// runFilter executes f and then closes arg.Out. Once the items
+// produced by f are no longer wanted, or f returns, the filter that
+// produces arg.In is told to stop (see ErrStopped). A panic in f is
+// reported as a *PanicError.
+func runFilter[T, U any](f StageOf[T, U], arg ArgOf[T, U], e *filterErrors) {
+	if arg.inStop != nil && arg.outStop != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-arg.outStop.done():
+				arg.inStop.raise()
+			case <-finished:
+			}
+		}()
+	}
+	err := runRecovered(f, arg)
+	if errors.Is(err, ErrStopped) {
+		err = nil
+	}
+	arg.inStop.raise()
+	if err != nil && arg.env != nil && arg.env.errors != nil {
+		arg.env.errors.add(err, arg.env.maxErrors)
+	}
+	e.record(err)
 	close(arg.Out)
 	for range arg.In { // Discard all unhandled input
 	}
@@ -2,10 +2,23 @@ package stream_test
 
 import (
 	"github.com/ghemawat/stream"
+	"github.com/ghemawat/stream/streamtest"
 
 	"bytes"
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 func ExampleSequence() {
@@ -49,474 +62,3060 @@ func ExampleRun() {
 	// error: <nil>
 }
 
+func ExampleRunner() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := stream.NewRunner(stream.WithContext(ctx))
+	err := r.Run(
+		stream.FilterFunc(func(arg stream.Arg) error {
+			return arg.Context().Err()
+		}),
+	)
+	fmt.Println(err)
+	// Output:
+	// stage 1 (stream_test.ExampleRunner): context canceled
+}
+
+func ExampleWithLogger() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "elapsed" {
+				return slog.Attr{} // Omit varying attributes
+			}
+			return a
+		},
+	}))
+	stream.NewRunner(stream.WithLogger(logger)).Run(
+		stream.Named("numbers", stream.Numbers(1, 3)),
+	)
+	// Output:
+	// level=DEBUG msg="stream: stage started" stage=0 name=numbers
+	// level=DEBUG msg="stream: stage finished" stage=0 name=numbers err=<nil>
+}
+
+func ExampleArg_Report() {
+	r := stream.NewRunner(stream.WithReporter(func(err error) {
+		fmt.Println("reported:", err)
+	}))
+	out, err := r.Contents(
+		stream.Items("1", "two", "3"),
+		stream.FilterFunc(func(arg stream.Arg) error {
+			for s := range arg.In {
+				if _, err := strconv.Atoi(s); err != nil {
+					arg.Report(err)
+					continue
+				}
+				arg.Out <- s
+			}
+			return nil
+		}),
+	)
+	fmt.Println(out, err)
+	// Output:
+	// reported: strconv.Atoi: parsing "two": invalid syntax
+	// [1 3] <nil>
+}
+
+func ExampleOnError() {
+	r := stream.NewRunner(stream.OnError(func(err error) stream.Action {
+		var e *stream.ItemError
+		if errors.As(err, &e) && e.Item == "/no_such_file" {
+			return stream.ReplaceWith("missing " + e.Item)
+		}
+		return stream.Abort
+	}))
+	err := r.Run(
+		stream.Items("/", "/no_such_file"),
+		stream.Stat("found %p"),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(err)
+	// Output:
+	// found /
+	// missing /no_such_file
+	// <nil>
+}
+
+func ExampleContinueOnError() {
+	var problems []string
+	r := stream.NewRunner(
+		stream.ContinueOnError(),
+		stream.WithReporter(func(err error) {
+			var e *stream.ItemError
+			if errors.As(err, &e) {
+				problems = append(problems, e.Item)
+			}
+		}),
+	)
+	err := r.Run(
+		stream.Cat("/no_such_file", "errors.go"),
+		stream.First(1),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(err, problems)
+	// Output:
+	// package stream
+	// <nil> [/no_such_file]
+}
+
+func ExampleWithWatchdog() {
+	// The second filter never reads its input or produces output until
+	// it gives up, so the first filter blocks once its output channel
+	// is full.
+	giveUp := make(chan bool)
+	r := stream.NewRunner(stream.WithWatchdog(50*time.Millisecond, func(s *stream.Stall) {
+		for _, st := range s.Stages {
+			fmt.Println(st.Index, st.State)
+		}
+		close(giveUp)
+	}))
+	r.Run(
+		stream.Repeat("x", 10000),
+		stream.FilterFunc(func(arg stream.Arg) error {
+			<-giveUp
+			return nil
+		}),
+	)
+	// Output:
+	// 0 waiting to write output
+	// 1 not reading input
+}
+
+func ExampleMaxErrors() {
+	r := stream.NewRunner(stream.ContinueOnError(), stream.MaxErrors(3))
+	err := r.Run(
+		stream.Items("/", "/no_such_1", "/no_such_2", "/no_such_3", "/no_such_4", "/"),
+		stream.Stat("%p"),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(errors.Is(err, stream.ErrTooManyErrors))
+	var se *stream.StageError
+	fmt.Println(errors.As(err, &se), se.Stage)
+	// Output:
+	// /
+	// true
+	// true 2
+}
+
+func ExampleMaxErrors_identicalFailures() {
+	// Every item fails in the same way; each failure is counted.
+	var reported atomic.Int32
+	r := stream.NewRunner(
+		stream.ContinueOnError(),
+		stream.WithReporter(func(error) { reported.Add(1) }),
+		stream.MaxErrors(3),
+	)
+	err := r.Run(
+		stream.Items("x", "x", "x", "x", "x"),
+		stream.Stat("%p"),
+	)
+	fmt.Println(errors.Is(err, stream.ErrTooManyErrors), reported.Load())
+	// Output:
+	// true 2
+}
+
+func ExampleMemoryBudget() {
+	r := stream.NewRunner(stream.MemoryBudget(1000))
+	err := r.Run(
+		stream.Numbers(1, 100),
+		stream.Last(10), // Fits in the budget
+		stream.Sort(),
+	)
+	fmt.Println(err)
+	err = r.Run(
+		stream.Numbers(1, 100),
+		stream.Sort(), // Exceeds the budget
+	)
+	fmt.Println(errors.Is(err, stream.ErrMemoryBudget))
+	// Output:
+	// <nil>
+	// true
+}
+
+type printCollector struct{}
+
+func (printCollector) Collect(stages []stream.StageMetrics) {
+	for _, m := range stages {
+		if m.Done {
+			fmt.Println(m.Index, m.ItemsIn, m.ItemsOut, m.BytesOut)
+		}
+	}
+}
+
+func ExampleWithCollector() {
+	r := stream.NewRunner(stream.WithCollector(printCollector{}, time.Hour))
+	r.Run(
+		stream.Numbers(1, 100),
+		stream.Grep("7"),
+		stream.Grep("^7"),
+	)
+	// Output:
+	// 0 0 100 192
+	// 1 100 19 37
+	// 2 19 11 21
+}
+
+func ExamplePublishMetrics() {
+	c := stream.PublishMetrics("example_pipeline")
+	r := stream.NewRunner(stream.WithCollector(c, time.Hour))
+	for i := 0; i < 2; i++ {
+		r.Run(
+			stream.Named("numbers", stream.Numbers(1, 10)),
+			stream.Named("grep", stream.Grep("1")),
+		)
+	}
+	totals := c.Totals()
+	for _, name := range []string{"numbers", "grep"} {
+		t := totals[name]
+		fmt.Println(name, t.Executions, t.ItemsOut, t.Items.Counts)
+	}
+	fmt.Println(expvar.Get("example_pipeline") != nil)
+	// Output:
+	// numbers 2 20 [0 2 0 0 0 0 0 0 0]
+	// grep 2 4 [0 2 0 0 0 0 0 0 0]
+	// true
+}
+
+func ExampleDebug() {
+	stream.Run(
+		stream.Numbers(1, 12),
+		stream.Debug("numbers").To(os.Stdout).TimeFormat(""),
+		stream.Grep("1"),
+		stream.Debug("grep").To(os.Stdout).TimeFormat("").Enabled(false),
+	)
+	// Output:
+	// numbers #1 1
+	// numbers #2 2
+	// numbers #3 3
+	// numbers #4 4
+	// numbers #5 5
+	// numbers #6 6
+	// numbers #7 7
+	// numbers #8 8
+	// numbers #9 9
+	// numbers #10 10
+	// numbers #11 11
+	// numbers #12 12
+}
+
+func ExampleProgressFunc() {
+	stream.Run(
+		stream.Numbers(1, 25),
+		stream.ProgressFunc(func(p stream.ProgressStatus) {
+			fmt.Println(p.Items, p.Total, p.Done)
+		}).Every(10).Total(25),
+	)
+	// Output:
+	// 10 25 false
+	// 20 25 false
+	// 25 25 true
+}
+
+func ExampleProgressStatus_String() {
+	fmt.Println(stream.ProgressStatus{Items: 1200, Elapsed: 4 * time.Second, Rate: 300})
+	fmt.Println(stream.ProgressStatus{Items: 1200, Total: 5000, Elapsed: 4 * time.Second, Rate: 300, ETA: 13 * time.Second})
+	// Output:
+	// 1200 items in 4s (300/s)
+	// 1200/5000 items (24%) in 4s (300/s), ETA 13s
+}
+
+func ExampleProgressBar() {
+	var progress bytes.Buffer
+	clock := steppingClock{streamtest.NewClock(time.Now()), 2 * time.Second}
+	stream.NewRunner(stream.WithClock(clock)).Run(
+		stream.Numbers(1, 1000),
+		stream.ProgressBar(&progress).Total(1000),
+	)
+	fmt.Print(progress.String())
+	// Output:
+	// 1000/1000 items (100%) in 2s (500/s)
+}
+
+func ExampleNamed() {
+	err := stream.Run(
+		stream.Items("a", "b"),
+		stream.Named("check", stream.FilterFunc(func(arg stream.Arg) error {
+			for s := range arg.In {
+				if s == "b" {
+					return fmt.Errorf("bad item %q", s)
+				}
+			}
+			return nil
+		})),
+	)
+	fmt.Println(err)
+	// Output:
+	// stage 2 (check): bad item "b"
+}
+
+func ExampleWrap() {
+	stream.Run(
+		stream.Numbers(1, 3),
+		stream.Wrap(stream.WriteLines(os.Stdout),
+			func(stream.Arg) { fmt.Println("start") },
+			func(_ stream.Arg, err error) { fmt.Println("end", err) }),
+	)
+	// Output:
+	// start
+	// 1
+	// 2
+	// 3
+	// end <nil>
+}
+
+func ExampleWithMiddleware() {
+	var stages atomic.Int32
+	count := func(f stream.Filter) stream.Filter {
+		return stream.Wrap(f, func(stream.Arg) { stages.Add(1) }, nil)
+	}
+	r := stream.NewRunner(stream.WithMiddleware(count))
+	r.Run(
+		stream.Numbers(1, 10),
+		stream.Named("odd", stream.Grep("[13579]$")),
+		stream.First(2),
+	)
+	fmt.Println(stages.Load())
+	err := r.Run(stream.Numbers(1, 3), stream.Columns(0))
+	fmt.Println(err)
+	// Output:
+	// 3
+	// stage 2 (Columns): stream.Columns: invalid column number 0
+}
+
+func ExampleParse() {
+	f, err := stream.Parse(`numbers 1 30 | grep '[13]$' | sort -nr 1 | first 4`)
+	if err != nil {
+		panic(err)
+	}
+	stream.Run(f, stream.WriteLines(os.Stdout))
+	// Output:
+	// 23
+	// 21
+	// 13
+	// 11
+}
+
+func ExampleParse_error() {
+	_, err := stream.Parse("numbers 1 10 | frobnicate")
+	fmt.Println(err)
+	// Output:
+	// stream.Parse: stage 2: unknown filter "frobnicate"
+}
+
+func ExampleParse_comm() {
+	f, err := os.CreateTemp("", "comm")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("b\nc\nd\n")
+	f.Close()
+	p, err := stream.Parse("items a b c | comm -23 " + f.Name())
+	if err != nil {
+		panic(err)
+	}
+	stream.Run(p, stream.WriteLines(os.Stdout))
+	_, err = stream.Parse("comm -123 " + f.Name())
+	fmt.Println(err)
+	// Output:
+	// a
+	// stream.Parse: stage 1: comm: all columns suppressed
+}
+
+func ExampleParse_uniq() {
+	f, err := stream.Parse(`items "a1 x" "a1 y" "b2 z" | uniq -k 1`)
+	if err != nil {
+		panic(err)
+	}
+	stream.Run(f, stream.WriteLines(os.Stdout))
+	// Output:
+	// a1 x
+	// b2 z
+}
+
+func ExampleRegisterFilter() {
+	stream.RegisterFilter("upper", func(args []string) (stream.Filter, error) {
+		return stream.Map(strings.ToUpper), nil
+	})
+	f, _ := stream.Parse(`items "hello world" b\ c | upper`)
+	stream.Run(f, stream.WriteLines(os.Stdout))
+	// Output:
+	// HELLO WORLD
+	// B C
+}
+
+func ExampleLoadPipeline() {
+	f, err := stream.LoadPipeline(strings.NewReader(`{"stages": [
+		{"filter": "numbers", "args": [1, 20]},
+		{"filter": "grep", "args": ["-v", "1"], "name": "no-ones"},
+		{"filter": "last", "args": [3]}
+	]}`))
+	if err != nil {
+		panic(err)
+	}
+	stream.Run(f, stream.WriteLines(os.Stdout))
+	// Output:
+	// 8
+	// 9
+	// 20
+}
+
+func ExampleCheckpoint() {
+	dir, err := os.MkdirTemp("", "checkpoint")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "squares")
+	runs := 0
+	square := stream.FilterFunc(func(arg stream.Arg) error {
+		runs++
+		for s := range arg.In {
+			n, _ := strconv.Atoi(s)
+			arg.Out <- strconv.Itoa(n * n)
+		}
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		out, err := stream.Contents(
+			stream.Numbers(1, 4),
+			stream.Checkpoint(file, square),
+		)
+		fmt.Println(out, err)
+	}
+	fmt.Println(runs)
+	// Output:
+	// [1 4 9 16] <nil>
+	// [1 4 9 16] <nil>
+	// 1
+}
+
+func ExampleCheckpointFilter_ResumeBy() {
+	dir, err := os.MkdirTemp("", "checkpoint")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "out")
+	// Simulate an earlier execution that was interrupted after
+	// processing two items.
+	os.WriteFile(file+".partial", []byte("1 done\x002 done\x003 do"), 0666)
+	processed := stream.Map(func(s string) string {
+		fmt.Println("processing", s)
+		return s + " done"
+	})
+	out, err := stream.Contents(
+		stream.Numbers(1, 4),
+		stream.Checkpoint(file, processed).ResumeBy(func(s string) string {
+			return strings.Fields(s)[0]
+		}),
+	)
+	fmt.Println(out, err)
+	// Output:
+	// processing 3
+	// processing 4
+	// [1 done 2 done 3 done 4 done] <nil>
+}
+
+func ExampleBuffer() {
+	b := stream.Buffer().MemoryLimit(100) // Spill most items to disk
+	defer b.Close()
+	stream.Run(stream.Numbers(1, 1000), b)
+	// Compute the mean in a first pass, then print items larger than
+	// the mean in a second pass.
+	sum, n := 0, 0
+	stream.ForEach(b.Replay(), func(s string) {
+		v, _ := strconv.Atoi(s)
+		sum += v
+		n++
+	})
+	mean := sum / n
+	out, err := stream.Contents(
+		b.Replay(),
+		stream.If(func(s string) bool {
+			v, _ := strconv.Atoi(s)
+			return v > mean+495
+		}),
+	)
+	fmt.Println(mean, out, err)
+	// Output:
+	// 500 [996 997 998 999 1000] <nil>
+}
+
+func ExampleForEachContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	err := stream.ForEachContext(ctx, stream.Numbers(1, 1<<62), func(s string) {
+		if n++; n == 3 {
+			cancel()
+		}
+	})
+	fmt.Println(errors.Is(err, context.Canceled))
+	// Output:
+	// true
+}
+
+func ExampleContentsContext() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := stream.ContentsContext(ctx,
+		stream.Items("a", "b"),
+		stream.Cycle(0),
+		stream.Grep("c"),
+	)
+	fmt.Println(err)
+	// Output:
+	// stage 2 (Cycle): context deadline exceeded
+}
+
+func ExampleArg_Send() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := stream.RunContext(ctx, stream.FilterFunc(func(arg stream.Arg) error {
+		for {
+			if err := arg.Send("y"); err != nil {
+				return err
+			}
+		}
+	}))
+	fmt.Println(err)
+	// Output:
+	// stage 1 (stream_test.ExampleArg_Send): context canceled
+}
+
+func ExampleMapOf() {
+	type point struct{ x, y int }
+	points, err := stream.ContentsOf(stream.Then(
+		stream.Items("1,2", "3,4", "5,6"),
+		stream.MapOf(func(s string) point {
+			var p point
+			fmt.Sscanf(s, "%d,%d", &p.x, &p.y)
+			return p
+		}),
+	))
+	fmt.Println(points, err)
+	// Output:
+	// [{1 2} {3 4} {5 6}] <nil>
+}
+
+func ExampleThen() {
+	result, _ := stream.ContentsOf(
+		stream.Then(
+			stream.Then(
+				stream.ItemsOf(3, 1, 4, 1, 5, 9, 2, 6),
+				stream.SequenceOf(
+					stream.IfOf(func(x int) bool { return x%2 == 1 }),
+					stream.MapOf(func(x int) int { return x * x }),
+				),
+			),
+			stream.MapOf(strconv.Itoa),
+		),
+	)
+	fmt.Println(strings.Join(result, " "))
+	// Output:
+	// 9 1 1 25 81
+}
+
+func ExamplePanicError() {
+	err := stream.Run(
+		stream.Numbers(1, 10),
+		stream.Named("parse", stream.Map(func(s string) string {
+			if s == "7" {
+				panic("unlucky number")
+			}
+			return s
+		})),
+	)
+	var p *stream.PanicError
+	fmt.Println(err)
+	fmt.Println(errors.As(err, &p) && len(p.Stack) > 0)
+	// Output:
+	// stage 2 (parse): panic: unlucky number
+	// true
+}
+
+func ExampleStageError() {
+	err := stream.Run(
+		stream.Items("hello", "world"),
+		stream.Grep("["),
+		stream.WriteLines(os.Stdout),
+	)
+	var e *stream.StageError
+	if errors.As(err, &e) {
+		fmt.Println(e.Stage, e.Name)
+	}
+	fmt.Println(err)
+	// Output:
+	// 2 Grep
+	// stage 2 (Grep): error parsing regexp: missing closing ]: `[`
+}
+
+func ExampleStageError_name() {
+	fail := func(stream.Filter) stream.Filter {
+		return stream.FilterFunc(func(stream.Arg) error { return errors.New("failed") })
+	}
+	r := stream.NewRunner(stream.WithMiddleware(fail))
+	for _, f := range []stream.Filter{
+		stream.Grep("a"),
+		stream.GrepNot("a"),
+		stream.ExpandEnv(),
+		stream.ShellQuote(),
+		stream.Map(strings.ToUpper),
+	} {
+		fmt.Println(r.Run(f))
+	}
+	// Output:
+	// stage 1 (Grep): failed
+	// stage 1 (GrepNot): failed
+	// stage 1 (ExpandEnv): failed
+	// stage 1 (ShellQuote): failed
+	// stage 1 (Map): failed
+}
+
+func ExampleWithBatchSize() {
+	r := stream.NewRunner(stream.WithBatchSize(100))
+	n := 0
+	err := r.ForEach(stream.Sequence(
+		stream.Repeat("hello", 1000),
+		stream.Map(strings.ToUpper),
+		stream.NumberLines(), // Sees one item at a time
+		stream.Grep("7 HELLO"),
+		stream.First(3),
+	), func(s string) {
+		n++
+		fmt.Println(s)
+	})
+	fmt.Println(n, err)
+	// Output:
+	//     7 HELLO
+	//    17 HELLO
+	//    27 HELLO
+	// 3 <nil>
+}
+
+func ExampleWithLazyExecution() {
+	r := stream.NewRunner(stream.WithLazyExecution())
+	out, err := r.Contents(
+		stream.Repeat("x", 1<<40),
+		stream.Map(strings.ToUpper),
+		stream.NumberLines(), // Runs in its own goroutine
+		stream.Grep("7 X"),
+		stream.First(2),
+	)
+	fmt.Println(out, err)
+	// Output:
+	// [    7 X    17 X] <nil>
+}
+
+func ExampleTee() {
+	var log bytes.Buffer
+	var count int
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.Tee(
+			stream.WriteLines(&log),
+			stream.FilterFunc(func(arg stream.Arg) error {
+				for range arg.In {
+					count++
+				}
+				return nil
+			}),
+		),
+		stream.Grep("1"),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(strings.Fields(log.String()), count)
+	// Output:
+	// 1
+	// 10
+	// [1 2 3 4 5 6 7 8 9 10] 10
+}
+
+func ExampleMerge() {
+	stream.Run(
+		stream.Merge(
+			stream.Numbers(1, 3),
+			stream.Items("a", "b"),
+		).InOrder(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2
+	// 3
+	// a
+	// b
+}
+
+func ExampleMergeFilter_InOrder_memoryBudget() {
+	// The held output of the second filter exceeds the budget, which
+	// stops that filter long before it would otherwise finish.
+	var produced atomic.Int64
+	err := stream.NewRunner(stream.MemoryBudget(1000)).Run(
+		stream.Merge(
+			stream.Items("a"),
+			stream.Sequence(
+				stream.Numbers(1, 1<<40),
+				stream.Map(func(s string) string { produced.Add(1); return s }),
+			),
+		).InOrder(),
+	)
+	fmt.Println(errors.Is(err, stream.ErrMemoryBudget), produced.Load() < 1e6)
+	// Output:
+	// true true
+}
+
+func ExampleMerge_sharedInput() {
+	stream.Run(
+		stream.Items("apple", "banana", "cherry"),
+		stream.Merge(
+			stream.Grep("an"),
+			stream.Map(strings.ToUpper),
+		),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// APPLE
+	// BANANA
+	// CHERRY
+	// banana
+}
+
+func ExampleZip() {
+	stream.Run(
+		stream.Zip(
+			stream.Items("a", "b", "c"),
+			stream.Numbers(1, 2),
+		),
+		stream.Map(strconv.Quote),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// "a\t1"
+	// "b\t2"
+	// "c\t"
+}
+
+func ExampleZipFilter_JoinFunc() {
+	stream.Run(
+		stream.Items("apple", "Banana", "cherry"),
+		stream.Zip(stream.Sort(), stream.Sort().By(func(a, b string) bool {
+			return strings.ToLower(a) < strings.ToLower(b)
+		})).JoinFunc(func(a, b string) string {
+			if a == b {
+				return a
+			}
+			return a + " | " + b
+		}),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// Banana | apple
+	// apple | Banana
+	// cherry
+}
+
+func ExamplePartition() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.Partition(
+			func(s string) bool { n, _ := strconv.Atoi(s); return n%2 == 0 },
+			stream.Map(func(s string) string { return s + " even" }),
+			stream.First(2),
+		),
+		stream.Sort().Num(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2 even
+	// 3
+	// 4 even
+	// 6 even
+	// 8 even
+	// 10 even
+}
+
+func ExampleJoin() {
+	sizes := stream.Items(
+		"a.go 120",
+		"b.go 340",
+		"d.go 50",
+	)
+	stream.Run(
+		stream.Items("alice a.go", "bob b.go", "carol c.go", "dave a.go"),
+		stream.Join(sizes).OnColumns(2, 1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// alice a.go 120
+	// bob b.go 340
+	// dave a.go 120
+}
+
+func ExampleJoinFilter_Outer() {
+	stream.Run(
+		stream.Items("a 1", "b 2", "c 3"),
+		stream.Join(stream.Items("a x", "c y", "c z", "d w")).Outer(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a 1 x
+	// b 2
+	// c 3 y
+	// c 3 z
+	// d w
+}
+
+func ExampleConcat() {
+	stream.Run(
+		stream.Concat(stream.Items("a", "b"), stream.Numbers(1, 2), stream.Repeat("c", 2)),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// 1
+	// 2
+	// c
+	// c
+}
+
+func ExampleConcat_first() {
+	stream.Run(
+		stream.Concat(stream.Items("a", "b"), stream.Numbers(1, 1<<30)),
+		stream.First(4),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// 1
+	// 2
+}
+
+func ExampleRoute() {
+	stream.Run(
+		stream.Items("E1", "W1", "I1", "E2", "W2", "W3", "I2"),
+		stream.Route(map[string]stream.Filter{
+			"^E": nil,
+			"^W": stream.First(1),
+		}).Default(stream.Map(strings.ToLower)),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// E1
+	// E2
+	// W1
+	// i1
+	// i2
+}
+
+func ExampleRouteFilter_Case() {
+	stream.Run(
+		stream.Items("WARNING 1", "W1", "WARNING 2", "W2"),
+		stream.Route(nil).
+			Case("^WARN", stream.Map(strings.ToLower)).
+			Case("^W", stream.First(1)),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// W1
+	// warning 1
+	// warning 2
+}
+
+func ExampleTakeUntil() {
+	stream.Run(
+		stream.Numbers(1, 1<<30),
+		stream.TakeUntil("^4$"),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Items("Subject: hi", "To: you", "", "body"),
+		stream.TakeUntil("^$").Inclusive(),
+		stream.Map(strconv.Quote),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2
+	// 3
+	// "Subject: hi"
+	// "To: you"
+	// ""
+}
+
+func ExampleEveryNth() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.EveryNth(4),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.EveryNth(3).Offset(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 5
+	// 9
+	// 3
+	// 6
+	// 9
+}
+
+func ExampleChunk() {
+	stream.Run(
+		stream.Numbers(1, 8),
+		stream.Chunk(3, ","),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1,2,3
+	// 4,5,6
+	// 7,8
+}
+
+func ExampleScan() {
+	stream.Run(
+		stream.Items("a", "b", "c"),
+		stream.Scan("", func(acc, s string) string { return acc + s }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// ab
+	// abc
+}
+
+func ExampleReduce() {
+	stream.Run(
+		stream.Items("apple", "fig", "banana"),
+		stream.Reduce("", func(longest, s string) string {
+			if len(s) > len(longest) {
+				return s
+			}
+			return longest
+		}),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// banana
+}
+
+func ExampleSum() {
+	listing := []string{
+		"total 12",
+		"-rw-r--r-- 1 u g 1200 Jan  1 12:00 a.txt",
+		"-rw-r--r-- 1 u g   34 Jan  1 12:00 b.txt",
+	}
+	stream.Run(
+		stream.ItemsFromSlice(listing),
+		stream.Sum().Column(5).IgnoreInvalid(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1234
+}
+
+func ExampleMean() {
+	for _, f := range []stream.Filter{stream.Count(), stream.Mean(), stream.Min(), stream.Max()} {
+		stream.Run(stream.Items("4", "1.5", "-2", "8.5"), f, stream.WriteLines(os.Stdout))
+	}
+	err := stream.Run(stream.Items("1", "two"), stream.Max())
+	fmt.Println(err)
+	// Output:
+	// 4
+	// 3
+	// -2
+	// 8.5
+	// stage 2 (Aggregate): stream.Max: "two" is not a number
+}
+
+func ExampleSortFilter_External() {
+	stream.Run(
+		stream.Items("d", "f", "b", "a", "e", "c", "g"),
+		stream.Sort().TextDecreasing(0).External("", 100),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// g
+	// f
+	// e
+	// d
+	// c
+	// b
+	// a
+}
+
+func ExampleSortFilter_External_binary() {
+	stream.Run(
+		stream.Items("b\x00a", "a\x00b", "\x00", "a"),
+		stream.Sort().External("", 40),
+		stream.Map(strconv.Quote),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// "\x00"
+	// "a"
+	// "a\x00b"
+	// "b\x00a"
+}
+
+func ExampleSortFilter_Parallel() {
+	stream.Run(
+		stream.Numbers(1, 100000),
+		stream.Sort().NumDecreasing(1).Parallel(4),
+		stream.First(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 100000
+	// 99999
+	// 99998
+}
+
+func ExampleSortFilter_Delimiter() {
+	stream.Run(
+		stream.Items(
+			"root:x:0:0:root:/root:/bin/bash",
+			"nobody:x:65534:65534::/nonexistent:/usr/sbin/nologin",
+			"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin",
+		),
+		stream.Sort().Delimiter(':').NumDecreasing(3),
+		stream.Columns(1, 5, 6).Delimiter(':'),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// nobody::/nonexistent
+	// daemon:daemon:/usr/sbin
+	// root:root:/root
+}
+
+func ExampleSortFilter_HumanSize() {
+	stream.Run(
+		stream.Items("1.2G\tdata", "4.0K\tetc", "23M\tbin", "512\tREADME", "1k\tlib"),
+		stream.Sort().HumanSizeDecreasing(1),
+		stream.Columns(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// data
+	// bin
+	// etc
+	// lib
+	// README
+}
+
+func ExampleSortFilter_Version() {
+	stream.Run(
+		stream.Items("v1.2.10", "v1.10.0", "v1.2.9", "v1.2.10-rc1", "v1.2", "v1.2.09.1"),
+		stream.Sort().Version(0),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// v1.2
+	// v1.2.9
+	// v1.2.09.1
+	// v1.2.10-rc1
+	// v1.2.10
+	// v1.10.0
+}
+
+func ExampleSortFilter_Month() {
+	stream.Run(
+		stream.Items("Mar 3", "jan 10", "December 1", "Feb 28", "Jan 2"),
+		stream.Sort().Month(1).Num(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// Jan 2
+	// jan 10
+	// Feb 28
+	// Mar 3
+	// December 1
+}
+
+func ExampleSortFilter_Time() {
+	stream.Run(
+		stream.Items(
+			"deploy 02/01/2024",
+			"build 12/25/2023",
+			"test 01/15/2024",
+		),
+		stream.Sort().Time(2, "01/02/2006"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// build 12/25/2023
+	// test 01/15/2024
+	// deploy 02/01/2024
+}
+
+func ExampleSortFilter_Unique() {
+	stream.Run(
+		stream.Items("b 2", "a 1", "c 1", "b 2", "a 3"),
+		stream.Sort().Num(2).Unique(),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Items("b", "a", "b", "a", "a"),
+		stream.Sort().External("", 40).Unique(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a 1
+	// b 2
+	// a 3
+	// a
+	// b
+}
+
+func ExampleSortFilter_ByKey() {
+	stream.Run(
+		stream.Items("/usr/bin/zsh", "/bin/bash", "/usr/local/bin/fish"),
+		stream.Sort().ByKey(filepath.Base, false),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Items("page10.html", "page9.html", "page100.html"),
+		stream.Sort().ByKey(func(s string) string {
+			return strings.Trim(s, "abcdefghijklmnopqrstuvwxyz.")
+		}, true),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// /bin/bash
+	// /usr/local/bin/fish
+	// /usr/bin/zsh
+	// page9.html
+	// page10.html
+	// page100.html
+}
+
+func ExampleDedupFilter_MemoryLimit() {
+	// With this limit, the two most recent distinct items are remembered.
+	stream.Run(
+		stream.Items("a", "b", "a", "c", "d", "a", "d"),
+		stream.Dedup().MemoryLimit(40),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// c
+	// d
+	// a
+}
+
+func ExampleDedupFilter_MemoryLimit_approximate() {
+	err := stream.Run(
+		stream.Items("a", "b"),
+		stream.Dedup().Approximate(1000, 0.01).MemoryLimit(40),
+	)
+	fmt.Println(err)
+	// Output:
+	// stage 2 (Dedup): stream.Dedup: Approximate and MemoryLimit cannot be combined
+}
+
 func ExampleItems() {
 	stream.Run(
 		stream.Items("hello", "world"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// hello
-	// world
+	// hello
+	// world
+}
+
+func ExampleItemsFromSlice() {
+	items := []string{"a", "b"}
+	stream.Run(stream.ItemsFromSlice(items), stream.WriteLines(os.Stdout))
+	// Output:
+	// a
+	// b
+}
+
+func ExampleItemsFromChannel() {
+	ch := make(chan string)
+	go func() {
+		ch <- "hello"
+		ch <- "world"
+		close(ch)
+	}()
+	stream.Run(stream.ItemsFromChannel(ch), stream.WriteLines(os.Stdout))
+	// Output:
+	// hello
+	// world
+}
+
+func ExampleItemsFromSeq() {
+	stream.Run(
+		stream.ItemsFromSeq(strings.SplitSeq("a,b,c", ",")),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// c
+}
+
+func ExampleGenerate() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fib := stream.Generate(func(emit func(string) bool) {
+		for a, b := 0, 1; emit(strconv.Itoa(a)); a, b = b, a+b {
+		}
+	})
+	n := 0
+	stream.NewRunner(stream.WithContext(ctx)).ForEach(fib, func(s string) {
+		if n++; n <= 10 {
+			fmt.Print(s, " ")
+		} else {
+			cancel()
+		}
+	})
+	fmt.Println()
+	// Output:
+	// 0 1 1 2 3 5 8 13 21 34
+}
+
+func ExampleRandomStrings() {
+	r := stream.NewRunner(stream.WithRand(rand.NewSource(1)))
+	out, _ := r.Contents(stream.RandomStrings(3, "ab", 5))
+	for _, s := range out {
+		fmt.Println(len(s), strings.Trim(s, "ab") == "")
+	}
+	// Output:
+	// 5 true
+	// 5 true
+	// 5 true
+}
+
+func ExampleUUIDs() {
+	stream.Run(
+		stream.UUIDs(2),
+		stream.Grep(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		stream.Map(func(s string) string { return "valid" }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// valid
+	// valid
+}
+
+func ExampleKeysOf() {
+	m := map[string]int{"x": 1, "a": 2, "m": 3}
+	stream.Run(stream.KeysOf(m), stream.WriteLines(os.Stdout))
+	// Output:
+	// a
+	// m
+	// x
+}
+
+func ExampleValuesOf() {
+	m := map[int]string{3: "three", 1: "one", 2: "two"}
+	stream.Run(stream.ValuesOf(m), stream.WriteLines(os.Stdout))
+	// Output:
+	// one
+	// two
+	// three
+}
+
+func ExampleNumbers() {
+	stream.Run(
+		stream.Numbers(2, 5),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 2
+	// 3
+	// 4
+	// 5
+}
+
+func ExampleNumbersFilter_Step() {
+	stream.Run(
+		stream.Numbers(10, 1).Step(-3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10
+	// 7
+	// 4
+	// 1
+}
+
+func ExampleNumbersFilter_ZeroPad() {
+	stream.Run(
+		stream.Numbers(-1, 10).Step(5).ZeroPad(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// -01
+	// 004
+	// 009
+}
+
+func ExampleBigNumbers() {
+	x, _ := new(big.Int).SetString("99999999999999999999", 10)
+	y := new(big.Int).Add(x, big.NewInt(2))
+	stream.Run(stream.BigNumbers(x, y), stream.WriteLines(os.Stdout))
+	// Output:
+	// 99999999999999999999
+	// 100000000000000000000
+	// 100000000000000000001
+}
+
+func ExampleFloats() {
+	stream.Run(
+		stream.Floats(0, 1, 0.1).Precision(2),
+		stream.Grep(`[05]0$`),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(stream.Floats(1, 0, -0.25), stream.WriteLines(os.Stdout))
+	stream.Run(stream.Floats(0, 1, 0.1), stream.Chunk(11, " "), stream.WriteLines(os.Stdout))
+	// Output:
+	// 0.00
+	// 0.50
+	// 1.00
+	// 1
+	// 0.75
+	// 0.5
+	// 0.25
+	// 0
+	// 0 0.1 0.2 0.3 0.4 0.5 0.6 0.7 0.8 0.9 1
+}
+
+func ExampleFloats_error() {
+	fmt.Println(stream.Run(stream.Floats(0, 1, 0)))
+	fmt.Println(stream.Run(stream.Floats(0, math.NaN(), 1), stream.WriteLines(os.Stdout)))
+	// Output:
+	// stage 1 (Floats): stream.Floats: bad step 0
+	// stage 1 (Floats): stream.Floats: bad range 0 to NaN
+}
+
+func ExampleTimestamp() {
+	clock := streamtest.NewClock(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+	stream.NewRunner(stream.WithClock(clock)).Run(
+		stream.Items("started", "stopped"),
+		stream.Timestamp(time.DateTime),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 2024-05-06 07:08:09 started
+	// 2024-05-06 07:08:09 stopped
+}
+
+// steppingClock is a clock that advances by step every time it is read.
+type steppingClock struct {
+	*streamtest.Clock
+	step time.Duration
+}
+
+func (c steppingClock) Now() time.Time {
+	c.Advance(c.step)
+	return c.Clock.Now()
+}
+
+func ExampleElapsed() {
+	clock := steppingClock{streamtest.NewClock(time.Now()), 1500 * time.Millisecond}
+	stream.NewRunner(stream.WithClock(clock)).Run(
+		stream.Items("a", "b", "c"),
+		stream.Elapsed(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1.5s a
+	// 3s b
+	// 4.5s c
+}
+
+func ExampleElapsedFilter_SincePrevious() {
+	clock := steppingClock{streamtest.NewClock(time.Now()), time.Second}
+	stream.NewRunner(stream.WithClock(clock)).Run(
+		stream.Items("a", "b"),
+		stream.Elapsed().SincePrevious(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1s a
+	// 1s b
+}
+
+func ExampleMinLen() {
+	stream.Run(
+		stream.Items("a", "bb", "ccc"),
+		stream.MinLen(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// bb
+	// ccc
+}
+
+func ExampleLengthBetween() {
+	stream.Run(
+		stream.Items("née", "nee", "n"),
+		stream.LengthBetween(2, 3).Bytes(),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Items("née", "nee", "n"),
+		stream.MaxLen(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// nee
+	// née
+	// nee
+	// n
+}
+
+func ExampleMap() {
+	stream.Run(
+		stream.Items("hello", "there", "how", "are", "you?"),
+		stream.Map(func(s string) string {
+			return fmt.Sprintf("%d %s", len(s), s)
+		}),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 5 hello
+	// 5 there
+	// 3 how
+	// 3 are
+	// 4 you?
+}
+
+func ExampleExpandEnv() {
+	os.Setenv("STREAM_EXAMPLE_DIR", "/tmp")
+	stream.Run(
+		stream.Items("cd ${STREAM_EXAMPLE_DIR}", "ls $STREAM_EXAMPLE_DIR/x$STREAM_EXAMPLE_UNSET"),
+		stream.ExpandEnv(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// cd /tmp
+	// ls /tmp/x
+}
+
+func ExampleExpandMap() {
+	stream.Run(
+		stream.Items("Hello, ${name}!"),
+		stream.ExpandMap(map[string]string{"name": "world"}),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// Hello, world!
+}
+
+func ExampleComm() {
+	stream.Run(
+		stream.Items("a", "b", "d"),
+		stream.Comm(stream.Items("b", "c", "d", "e")),
+		stream.Map(func(s string) string { return strings.ReplaceAll(s, "\t", "-") }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// --b
+	// -c
+	// --d
+	// -e
+}
+
+func ExampleCommFilter_OnlyInInput() {
+	stream.Run(
+		stream.Items("a", "b", "d"),
+		stream.Comm(stream.Items("b", "c", "d", "e")).OnlyInInput(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+}
+
+func ExampleDiffAgainst() {
+	stream.Run(
+		stream.Items("a", "b", "c", "d", "e", "f", "g", "h", "i", "j"),
+		stream.DiffAgainst(stream.Items("a", "c", "d", "e", "f", "g", "h", "i", "J", "j", "k")).Context(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// --- input
+	// +++ other
+	// @@ -1,3 +1,2 @@
+	//  a
+	// -b
+	//  c
+	// @@ -9,2 +8,4 @@
+	//  i
+	// +J
+	//  j
+	// +k
+}
+
+func ExampleDiff() {
+	stream.Run(
+		stream.Diff(stream.Numbers(1, 5), stream.Items("1", "2", "three", "4", "5")).Context(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// --- a
+	// +++ b
+	// @@ -2,3 +2,3 @@
+	//  2
+	// -3
+	// +three
+	//  4
+}
+
+func ExampleDiff_memoryBudget() {
+	r := stream.NewRunner(stream.MemoryBudget(1000))
+	err := r.Run(stream.Diff(stream.Numbers(1, 20), stream.Numbers(21, 40)))
+	fmt.Println(errors.Is(err, stream.ErrMemoryBudget))
+	// Output:
+	// true
+}
+
+func ExampleInSet() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.InSet(stream.Items("3", "5", "11")),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 3
+	// 5
+}
+
+func ExampleNotInSet() {
+	stream.Run(
+		stream.Items("a.go", "b.go", "c.go"),
+		stream.NotInSet(stream.ItemsFromSlice([]string{"b.go"})),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a.go
+	// c.go
+}
+
+func ExampleDeleteMatch() {
+	stream.Run(
+		stream.Items("a1b22c333"),
+		stream.DeleteMatch(`[0-9]+`),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// abc
+}
+
+func ExampleKeepOnly() {
+	stream.Run(
+		stream.Items("a1b22c333", "none"),
+		stream.KeepOnly(`[0-9]+`),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 22
+	// 333
+}
+
+func ExampleSed() {
+	stream.Run(
+		stream.Items("# comment", "color: red  ", "Colour: blue", "a/b"),
+		stream.Sed(`/^#/d; s/[[:space:]]+$//; s/colou?r/hue/gi; s|/|\\|; s/(\w+): (\w+)/\2 <- & (\1$)/`),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// red <- hue: red (hue$)
+	// blue <- hue: blue (hue$)
+	// a\b
+}
+
+func ExampleSedFilter_Quiet() {
+	stream.Run(
+		stream.Numbers(1, 20),
+		stream.Sed(`/5/p; s/^1/one-/; /^one-[2-4]/p`).Quiet(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 5
+	// one-2
+	// one-3
+	// one-4
+	// 15
+}
+
+func ExampleParagraphs() {
+	stream.Run(
+		stream.Items("[a]", "x=1", "", "", "[b]", "y=2", "  ", "[c]", "x=3"),
+		stream.Paragraphs(),
+		stream.Grep(`(?m)^x=`),
+		stream.SplitParagraphs(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// [a]
+	// x=1
+	//
+	// [c]
+	// x=3
+}
+
+func ExampleIf() {
+	stream.Run(
+		stream.Numbers(1, 12),
+		stream.If(func(s string) bool { return len(s) > 1 }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10
+	// 11
+	// 12
+}
+
+func ExampleGrep() {
+	stream.Run(
+		stream.Numbers(1, 12),
+		stream.Grep(".."),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10
+	// 11
+	// 12
+}
+
+func ExampleGrepNot() {
+	stream.Run(
+		stream.Numbers(1, 12),
+		stream.GrepNot("^.$"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10
+	// 11
+	// 12
+}
+
+func ExampleUniq() {
+	stream.Run(
+		stream.Items("a", "b", "b", "c", "b"),
+		stream.Uniq(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// c
+	// b
+}
+
+func ExampleUniqWithCount() {
+	stream.Run(
+		stream.Items("a", "b", "b", "c"),
+		stream.UniqWithCount(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1 a
+	// 2 b
+	// 1 c
+}
+
+func ExampleParallel() {
+	stream.Run(
+		stream.Items("hello", "there", "how", "are", "you?"),
+		stream.Parallel(4,
+			stream.Map(func(s string) string {
+				return fmt.Sprintf("%d %s", len(s), s)
+			}),
+		),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 3 are
+	// 3 how
+	// 4 you?
+	// 5 hello
+	// 5 there
+}
+
+func ExampleGrepFiles() {
+	stream.Run(
+		stream.GrepFiles(`^func Grep\(`, "regexp.go"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// regexp.go:13:func Grep(r string) Filter {
+}
+
+func ExampleGrepFiles_longLines() {
+	dir, err := os.MkdirTemp("", "grepfiles")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	long := strings.Repeat("x", 100000)
+	os.WriteFile(filepath.Join(dir, "a"), []byte(long+"\nneedle 1\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "b"), []byte("needle 2\r\n"+long+"needle 3"), 0600)
+
+	stream.Run(
+		stream.GrepFiles("needle", dir),
+		stream.Map(func(s string) string {
+			s = strings.TrimPrefix(s, dir+string(filepath.Separator))
+			return strings.Replace(s, long, "...", 1)
+		}),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a:2:needle 1
+	// b:1:needle 2
+	// b:2:...needle 3
+}
+
+func ExampleSubstitute() {
+	stream.Run(
+		stream.Numbers(1, 5),
+		stream.Substitute("(3)", "$1$1"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2
+	// 33
+	// 4
+	// 5
+}
+
+func ExampleSort() {
+	stream.Run(
+		stream.Items("banana", "apple", "cheese", "apple"),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// apple
+	// apple
+	// banana
+	// cheese
+}
+
+func ExampleSort_multipleColumns() {
+	// Sort numerically by column 1. Break ties by sorting
+	// lexicographically by column 2.
+	stream.Run(
+		stream.Items(
+			"1970 march",
+			"1970 feb",
+			"1950 june",
+			"1980 sep",
+		),
+		stream.Sort().Num(1).Text(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1950 june
+	// 1970 feb
+	// 1970 march
+	// 1980 sep
+}
+
+func ExampleSorter_Num() {
+	stream.Run(
+		stream.Items(
+			"a 100",
+			"b 20.3",
+			"c notanumber", // Will sort last since column 2 is not a number
+			"d",            // Will sort earliest since column 2 is missing
+		),
+		stream.Sort().Num(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// d
+	// b 20.3
+	// a 100
+	// c notanumber
+}
+
+func ExampleSorter_NumDecreasing() {
+	stream.Run(
+		stream.Items(
+			"a 100",
+			"b 20",
+			"c notanumber",
+			"d",
+		),
+		stream.Sort().NumDecreasing(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// c notanumber
+	// a 100
+	// b 20
+	// d
+}
+
+func ExampleSorter_Text() {
+	stream.Run(
+		stream.Items(
+			"10 bananas",
+			"20 apples",
+			"30", // Will sort first since column 2 is missing
+		),
+		stream.Sort().Text(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 30
+	// 20 apples
+	// 10 bananas
+}
+
+func ExampleSorter_TextDecreasing() {
+	stream.Run(
+		stream.Items(
+			"10 bananas",
+			"20 apples",
+			"30", // Will sort first since column 2 is missing
+		),
+		stream.Sort().TextDecreasing(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10 bananas
+	// 20 apples
+	// 30
+}
+
+func ExampleSorter_By() {
+	stream.Run(
+		stream.Items("bananas", "apples", "pears"),
+		stream.Sort().By(func(a, b string) bool { return len(a) < len(b) }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// pears
+	// apples
+	// bananas
+}
+
+func ExampleUniqBy() {
+	stream.Run(
+		stream.Items("Apple", "apple", "Banana", "APPLE"),
+		stream.UniqBy(strings.ToLower),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// Apple
+	// Banana
+	// APPLE
+}
+
+func ExampleUniqByColumn() {
+	stream.Run(
+		stream.Items(
+			"10:00:01 disk full",
+			"10:00:02 disk full",
+			"10:00:03 cpu hot",
+		),
+		stream.UniqByColumn(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 10:00:01 disk full
+	// 10:00:03 cpu hot
+}
+
+func ExampleUniqFilter_By() {
+	stream.Run(
+		stream.Items("Apple", "apple", "Banana", "APPLE"),
+		stream.Uniq().By(strings.ToLower),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// Apple
+	// Banana
+	// APPLE
+}
+
+func ExampleUniqFilter_Column() {
+	stream.Run(
+		stream.Items(
+			"3b5d a/x.txt",
+			"3b5d b/x.txt",
+			"9f00 a/y.txt",
+		),
+		stream.Uniq().Column(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 3b5d a/x.txt
+	// 9f00 a/y.txt
+}
+
+func ExampleDedup() {
+	stream.Run(
+		stream.Items("b", "a", "b", "c", "a"),
+		stream.Dedup(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// b
+	// a
+	// c
+}
+
+func ExampleDedupFilter_By() {
+	stream.Run(
+		stream.Items("1 x", "2 y", "1 z"),
+		stream.Dedup().By(func(s string) string { return strings.Fields(s)[0] }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1 x
+	// 2 y
+}
+
+func ExampleDedupFilter_Approximate() {
+	out, _ := stream.Contents(
+		stream.Numbers(1, 10000),
+		stream.Cycle(3),
+		stream.Dedup().Approximate(10000, 0.01),
+	)
+	// Almost all distinct items survive, and no duplicates do.
+	fmt.Println(len(out) > 9800, len(out) <= 10000)
+	// Output:
+	// true true
+}
+
+func ExampleUniqWithCountFilter_SortByCount() {
+	stream.Run(
+		stream.Items("a", "b", "b", "c", "c", "c", "d"),
+		stream.UniqWithCount().SortByCount().CountAfter().Separator("\t").Width(2),
+		stream.Map(func(s string) string { return strings.ReplaceAll(s, "\t", "|") }),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// c| 3
+	// b| 2
+	// a| 1
+	// d| 1
+}
+
+func ExampleReverse() {
+	stream.Run(
+		stream.Items("a", "b"),
+		stream.Reverse(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// b
+	// a
+}
+
+func ExampleSample() {
+	stream.Run(
+		stream.Numbers(100, 200),
+		stream.Sample(4),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output not checked since it is non-deterministic.
+}
+
+func ExampleSampleWithSeed() {
+	stream.Run(
+		stream.Numbers(1, 100),
+		stream.SampleWithSeed(2, 100),
+		stream.Sort().Num(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 11
+	// 46
+}
+
+func ExampleFirst() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.First(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2
+	// 3
+}
+
+func ExampleFirst_unbounded() {
+	// Without early termination, these pipelines would never finish.
+	stream.Run(
+		stream.Command("yes"),
+		stream.Grep("y"),
+		stream.First(2),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Numbers(1, 1<<62),
+		stream.Sequence(stream.Grep("7$"), stream.First(2)),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// y
+	// y
+	// 7
+	// 17
+}
+
+func ExampleForEachWhile() {
+	err := stream.ForEachWhile(stream.Find("/"), func(s string) bool {
+		fmt.Println(s)
+		return false
+	})
+	fmt.Println(err)
+	// Output:
+	// /
+	// <nil>
+}
+
+func ExampleLast() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.Last(2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 9
+	// 10
+}
+
+func ExampleDropFirst() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.DropFirst(8),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 9
+	// 10
+}
+
+func ExampleDropLast() {
+	stream.Run(
+		stream.Numbers(1, 10),
+		stream.DropLast(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1
+	// 2
+	// 3
+	// 4
+	// 5
+	// 6
+	// 7
+}
+
+func ExampleCycle() {
+	stream.Run(
+		stream.Items("a", "b"),
+		stream.Cycle(3),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// a
+	// b
+	// a
+	// b
+	// a
+	// b
+}
+
+func ExampleCycle_forever() {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	err := stream.NewRunner(stream.WithContext(ctx)).ForEach(
+		stream.Sequence(stream.Items("x", "y"), stream.Cycle(0)),
+		func(s string) {
+			if n++; n == 1000 {
+				cancel()
+			}
+		})
+	fmt.Println(err)
+	// Output:
+	// stage 2 (Cycle): context canceled
+}
+
+func ExampleNumberLines() {
+	stream.Run(
+		stream.Items("a", "b"),
+		stream.NumberLines(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	//     1 a
+	//     2 b
+}
+
+func ExampleNumberLinesFilter_NonBlank() {
+	stream.Run(
+		stream.Items("a", "", "b"),
+		stream.NumberLines().Start(10).Width(3).ZeroPad().Separator(": ").NonBlank(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 010: a
+	//
+	// 011: b
+}
+
+func ExampleNumberLinesFilter_ByteOffsets() {
+	stream.Run(
+		stream.Items("hello", "", "world"),
+		stream.NumberLines().ByteOffsets().Width(0).Separator(":"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 0:hello
+	// 6:
+	// 7:world
+}
+
+func ExampleColumns() {
+	stream.Run(
+		stream.Items("hello world"),
+		stream.Columns(2, 3, 1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// world hello
+}
+
+func ExampleFind() {
+	stream.Run(
+		stream.Find(".").IfMode(os.FileMode.IsRegular),
+		stream.Grep("^stream[^/]*$"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// stream.go
+	// stream_test.go
+}
+
+func ExampleFindFilter_SkipDirIf() {
+	stream.Run(
+		stream.Find(".").SkipDirIf(func(d string) bool { return d == ".git" }),
+		stream.Grep("x"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// command_unix.go
+	// limits_linux.go
+	// regexp.go
+	// stat_unix.go
+	// xargs.go
+}
+
+func ExampleFind_multipleDirs() {
+	stream.Run(
+		stream.Find("sort.go", "find.go"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// sort.go
+	// find.go
+}
+
+func ExampleFindFilter_Also() {
+	stream.Run(
+		stream.Find("sort.go").Also("find.go"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// sort.go
+	// find.go
+}
+
+func ExampleFindFilter_Prune() {
+	stream.Run(
+		stream.Find(".").Prune(`^\.git$`),
+		stream.Grep("x"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// command_unix.go
+	// limits_linux.go
+	// regexp.go
+	// stat_unix.go
+	// xargs.go
+}
+
+func ExampleFindFilter_Relative() {
+	dir, err := os.MkdirTemp("", "find")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0700)
+	os.WriteFile(filepath.Join(dir, "a", "b", "c"), nil, 0600)
+	os.WriteFile(filepath.Join(dir, "d"), nil, 0600)
+
+	stream.Run(
+		stream.Find(dir).Relative(),
+		stream.Sort(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// .
+	// a
+	// a/b
+	// a/b/c
+	// d
+}
+
+func ExampleFind_error() {
+	err := stream.Run(stream.Find("/no_such_dir"))
+	if err == nil {
+		fmt.Println("stream.Find did not return expected error")
+	}
+	// Output:
+}
+
+func ExampleEvalSymlinks() {
+	stream.Run(
+		stream.Items("/", "/no_such_file"),
+		stream.EvalSymlinks().SkipFailures(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// /
+}
+
+func ExampleResolveFilter_KeepFailures() {
+	stream.Run(
+		stream.Items("/", "/no_such_file"),
+		stream.EvalSymlinks().KeepFailures(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// /
+	// /no_such_file
+}
+
+func ExampleAbs() {
+	stream.Run(
+		stream.Items("/a/b/../c", "/d/./e"),
+		stream.Abs(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// /a/c
+	// /d/e
+}
+
+func ExampleIfExists() {
+	stream.Run(
+		stream.Items("path.go", "no_such_file", "."),
+		stream.IfExists(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// path.go
+	// .
+}
+
+func ExampleExistsFilter_IfMode() {
+	stream.Run(
+		stream.Items("path.go", "no_such_file", "."),
+		stream.IfExists().IfMode(os.FileMode.IsDir),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// .
+}
+
+func ExampleIfNotExists() {
+	stream.Run(
+		stream.Items("path.go", "no_such_file", "."),
+		stream.IfNotExists(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// no_such_file
+}
+
+func ExampleStat() {
+	f, err := os.CreateTemp("", "stat")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("hello\n")
+	f.Close()
+
+	stream.Run(
+		stream.Items(f.Name()),
+		stream.Stat("%s %m"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 6 -rw-------
+}
+
+func ExampleStat_error() {
+	err := stream.Run(stream.Items("stat.go"), stream.Stat("%z"))
+	fmt.Println(err)
+	// Output:
+	// stage 2 (Stat): stream.Stat: unknown directive %z in format "%z"
+}
+
+func ExampleCopyTo() {
+	dir, err := os.MkdirTemp("", "copyto")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = stream.Run(
+		stream.Items("path.go", "stat.go copy_of_stat.go"),
+		stream.CopyTo(dir).Pairs(),
+		stream.Map(filepath.Base),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(err)
+
+	// Copying the copies onto themselves fails and leaves them intact.
+	err = stream.Run(
+		stream.Items(filepath.Join(dir, "path.go")),
+		stream.CopyTo(dir),
+	)
+	fmt.Println(err != nil)
+	info, _ := os.Stat(filepath.Join(dir, "path.go"))
+	fmt.Println(info.Size() > 0)
+	// Output:
+	// path.go
+	// copy_of_stat.go
+	// <nil>
+	// true
+	// true
+}
+
+func ExampleFileOpFilter_DryRun() {
+	stream.Run(
+		stream.Items("a.txt", "b.txt\trenamed.txt"),
+		stream.MoveTo("/backup").Pairs().DryRun(os.Stdout),
+	)
+	stream.Run(
+		stream.Items("c.txt", "my file.txt"),
+		stream.Remove().DryRun(os.Stdout),
+	)
+	// Output:
+	// mv a.txt /backup/a.txt
+	// mv b.txt /backup/renamed.txt
+	// rm c.txt
+	// rm my file.txt
+}
+
+func ExampleFileOpFilter_Pairs() {
+	stream.Run(
+		stream.Items(
+			"a.txt",
+			"b.txt renamed.txt",
+			"c.txt /archive/c.txt",
+			"my file.txt\told/my file.txt",
+		),
+		stream.CopyTo("/backup").Pairs().DryRun(os.Stdout),
+	)
+	// Output:
+	// cp a.txt /backup/a.txt
+	// cp b.txt /backup/renamed.txt
+	// cp c.txt /archive/c.txt
+	// cp my file.txt /backup/old/my file.txt
+}
+
+func ExampleFileOpFilter_KeepGoing() {
+	err := stream.Run(
+		stream.Items("/no_such_file", "path.go"),
+		stream.CopyTo("/no_such_dir").KeepGoing(),
+	)
+	fmt.Println(err != nil)
+
+	// Failures are subject to the error policy of the pipeline.
+	r := stream.NewRunner(
+		stream.OnError(func(error) stream.Action { return stream.ReplaceWith("failed") }),
+	)
+	r.Run(
+		stream.Items("/no_such_file"),
+		stream.CopyTo("/no_such_dir").KeepGoing(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// true
+	// failed
+}
+
+func ExampleDiskUsage() {
+	dir, err := os.MkdirTemp("", "du")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0700)
+	os.WriteFile(filepath.Join(dir, "a"), make([]byte, 1000), 0600)
+	os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 3000), 0600)
+
+	stream.Run(
+		stream.Items(dir, filepath.Join(dir, "sub")),
+		stream.DiskUsage(),
+		stream.Columns(1),
+		stream.WriteLines(os.Stdout),
+	)
+	stream.Run(
+		stream.Items(dir),
+		stream.DiskUsage().Human(),
+		stream.Columns(1),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 4000
+	// 3000
+	// 3.9K
+}
+
+func ExampleReconcile() {
+	a, _ := os.MkdirTemp("", "reconcile")
+	b, _ := os.MkdirTemp("", "reconcile")
+	defer os.RemoveAll(a)
+	defer os.RemoveAll(b)
+	os.WriteFile(filepath.Join(a, "same"), []byte("x"), 0600)
+	os.WriteFile(filepath.Join(b, "same"), []byte("x"), 0600)
+	os.WriteFile(filepath.Join(a, "edited"), []byte("old"), 0600)
+	os.WriteFile(filepath.Join(b, "edited"), []byte("new"), 0600)
+	os.WriteFile(filepath.Join(a, "deleted"), nil, 0600)
+	os.WriteFile(filepath.Join(b, "created"), nil, 0600)
+	os.Symlink("same", filepath.Join(a, "link"))
+	os.Symlink("edited", filepath.Join(b, "link"))
+
+	stream.Run(
+		stream.Reconcile(a, b),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// added created
+	// removed deleted
+	// changed edited
+	// changed link
+}
+
+func ExampleCat() {
+	stream.Run(
+		stream.Cat("stream_test.go"),
+		stream.Grep(`^func ExampleCat\(`),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// func ExampleCat() {
+}
+
+func ExampleCatFilter_WithFilename() {
+	stream.Run(
+		stream.Cat("regexp.go", "sort.go").WithFilename().WithLineNumbers(),
+		stream.Grep(`:1:`),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// regexp.go:1:package stream
+	// sort.go:1:package stream
+}
+
+func ExampleCatFilter_WithOffsets() {
+	stream.Run(
+		stream.Items("hello", "world"),
+		stream.Cat().WithLineNumbers().WithOffsets(),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 1:0:hello
+	// 2:6:world
 }
 
-func ExampleNumbers() {
+func ExampleTailFile() {
+	f, err := os.CreateTemp("", "tail")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(f.Name())
+	stream.Run(stream.Numbers(1, 100000), stream.WriteLines(f))
+	f.Close()
+
 	stream.Run(
-		stream.Numbers(2, 5),
+		stream.TailFile(f.Name(), 2),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// 99999
+	// 100000
+}
+
+func ExampleReadNulTerminated() {
+	var buf bytes.Buffer
+	stream.Run(
+		stream.Items("a b", "c\nd"),
+		stream.WriteNulTerminated(&buf),
+	)
+	stream.Run(
+		stream.ReadNulTerminated(&buf),
+		stream.Map(strconv.Quote),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// "a b"
+	// "c\nd"
+}
+
+func ExampleWriteLines() {
+	stream.Run(
+		stream.Numbers(1, 3),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
+	// 1
 	// 2
 	// 3
-	// 4
-	// 5
 }
 
-func ExampleMap() {
+func ExampleReadLines() {
 	stream.Run(
-		stream.Items("hello", "there", "how", "are", "you?"),
-		stream.Map(func(s string) string {
-			return fmt.Sprintf("%d %s", len(s), s)
-		}),
+		stream.ReadLines(bytes.NewBufferString("the\nquick\nbrown\nfox\n")),
+		stream.Sort(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 5 hello
-	// 5 there
-	// 3 how
-	// 3 are
-	// 4 you?
+	// brown
+	// fox
+	// quick
+	// the
 }
 
-func ExampleIf() {
+func ExampleDecodeText() {
+	inputs := [][]byte{
+		{0xFF, 0xFE, 'h', 0, 'i', 0, '\r', 0, '\n', 0, 0xAC, 0x20}, // UTF-16LE
+		{0xFE, 0xFF, 0xD8, 0x3D, 0xDE, 0x00},                       // UTF-16BE
+		[]byte("\xEF\xBB\xBFbonjour\n"),                            // UTF-8
+	}
+	for _, b := range inputs {
+		stream.Run(
+			stream.ReadLines(stream.DecodeText(bytes.NewReader(b))),
+			stream.Map(strconv.Quote),
+			stream.WriteLines(os.Stdout),
+		)
+	}
+	// Output:
+	// "hi"
+	// "€"
+	// "😀"
+	// "bonjour"
+}
+
+func ExampleCommand() {
 	stream.Run(
-		stream.Numbers(1, 12),
-		stream.If(func(s string) bool { return len(s) > 1 }),
+		stream.Numbers(1, 100),
+		stream.Command("wc", "-l"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 10
-	// 11
-	// 12
+	// 100
 }
 
-func ExampleGrep() {
+func ExampleCommand_outputOnly() {
 	stream.Run(
-		stream.Numbers(1, 12),
-		stream.Grep(".."),
+		stream.Command("find", ".", "-maxdepth", "1", "-type", "f", "-print"),
+		stream.Grep(`^\./stream.*\.go$`),
+		stream.Sort(),
 		stream.WriteLines(os.Stdout),
 	)
+
 	// Output:
-	// 10
-	// 11
-	// 12
+	// ./stream.go
+	// ./stream_test.go
 }
 
-func ExampleGrepNot() {
+func ExampleCommand_withError() {
+	err := stream.Run(stream.Command("no_such_command"))
+	if err == nil {
+		fmt.Println("execution of missing command succeeded unexpectedly")
+	}
+	// Output:
+}
+
+func ExampleCommandFilter_Env() {
 	stream.Run(
-		stream.Numbers(1, 12),
-		stream.GrepNot("^.$"),
+		stream.Command("sh", "-c", "echo $GREETING").Env("GREETING", "hello"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 10
-	// 11
-	// 12
+	// hello
 }
 
-func ExampleUniq() {
+func ExampleCommandFilter_Dir() {
 	stream.Run(
-		stream.Items("a", "b", "b", "c", "b"),
-		stream.Uniq(),
+		stream.Command("pwd").Dir("/"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// a
-	// b
-	// c
-	// b
+	// /
 }
 
-func ExampleUniqWithCount() {
+func ExampleCommandFilter_Stdin() {
 	stream.Run(
-		stream.Items("a", "b", "b", "c"),
-		stream.UniqWithCount(),
+		stream.Items("ignored"),
+		stream.Command("cat").Stdin(bytes.NewBufferString("from\nreader\n")),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 1 a
-	// 2 b
-	// 1 c
+	// from
+	// reader
 }
 
-func ExampleParallel() {
+func ExampleCommandFilter_MergeStderr() {
 	stream.Run(
-		stream.Items("hello", "there", "how", "are", "you?"),
-		stream.Parallel(4,
-			stream.Map(func(s string) string {
-				return fmt.Sprintf("%d %s", len(s), s)
-			}),
-		),
+		stream.Command("sh", "-c", "echo out; echo err >&2").MergeStderr(),
 		stream.Sort(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 3 are
-	// 3 how
-	// 4 you?
-	// 5 hello
-	// 5 there
+	// err
+	// out
+}
+
+func ExampleCommandFilter_Stderr() {
+	stream.Run(
+		stream.Command("sh", "-c", "echo out; echo err >&2").Stderr(os.Stdout),
+	)
+	// Output:
+	// err
+}
+
+func ExampleCommandFilter_CaptureStderr() {
+	err := stream.Run(
+		stream.Command("sh", "-c", "echo failed >&2; exit 3").CaptureStderr(),
+	)
+	fmt.Println(err)
+	// Output:
+	// stage 1 (Command): sh: exit status 3: failed
+}
+
+func ExampleCommandFilter_AllowExitCodes() {
+	err := stream.Run(
+		stream.Items("a", "b"),
+		stream.Command("grep", "c").AllowExitCodes(1),
+	)
+	fmt.Println(err)
+	// Output:
+	// <nil>
+}
+
+func ExampleExitError() {
+	err := stream.Run(stream.Command("sh", "-c", "exit 2"))
+	var e *stream.ExitError
+	if errors.As(err, &e) {
+		fmt.Println(e.Command, e.Code)
+	}
+	// Output:
+	// sh 2
+}
+
+func ExampleCommandFilter_Timeout() {
+	err := stream.Run(
+		stream.Command("sh", "-c", "sleep 10; echo done").Timeout(100*time.Millisecond),
+		stream.WriteLines(os.Stdout),
+	)
+	fmt.Println(errors.Is(err, context.DeadlineExceeded))
+	// Output:
+	// true
+}
+
+func ExampleCommandEach() {
+	stream.Run(
+		stream.Items("hello", "world"),
+		stream.CommandEach("echo", "<{}>"),
+		stream.WriteLines(os.Stdout),
+	)
+	// Output:
+	// <hello>
+	// <world>
 }
 
-func ExampleSubstitute() {
+func ExampleCommandEachFilter_Parallel() {
 	stream.Run(
-		stream.Numbers(1, 5),
-		stream.Substitute("(3)", "$1$1"),
+		stream.Numbers(1, 4),
+		stream.CommandEach("sh", "-c", "echo {}; echo {}{}").Parallel(2),
+		stream.Sort().Num(1),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
 	// 1
 	// 2
-	// 33
+	// 3
 	// 4
-	// 5
+	// 11
+	// 22
+	// 33
+	// 44
 }
 
-func ExampleSort() {
-	stream.Run(
-		stream.Items("banana", "apple", "cheese", "apple"),
-		stream.Sort(),
+func ExampleCommandEach_failure() {
+	err := stream.Run(
+		stream.Items("0", "3", "0"),
+		stream.CommandEach("sh", "-c", "echo {}; exit {}"),
+		stream.WriteLines(os.Stdout),
+	)
+	var x *stream.ExitError
+	fmt.Println(errors.As(err, &x), x.Code)
+
+	stream.NewRunner(
+		stream.OnError(func(error) stream.Action { return stream.ReplaceWith("failed") }),
+	).Run(
+		stream.Items("0", "3", "0"),
+		stream.CommandEach("sh", "-c", "echo {}; exit {}").Parallel(0),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// apple
-	// apple
-	// banana
-	// cheese
+	// 0
+	// true 3
+	// 0
+	// failed
+	// 0
 }
 
-func ExampleSort_multipleColumns() {
-	// Sort numerically by column 1. Break ties by sorting
-	// lexicographically by column 2.
-	stream.Run(
-		stream.Items(
-			"1970 march",
-			"1970 feb",
-			"1950 june",
-			"1980 sep",
-		),
-		stream.Sort().Num(1).Text(2),
-		stream.WriteLines(os.Stdout),
+func ExampleCommandEachFilter_Parallel_failure() {
+	dir, err := os.MkdirTemp("", "commandeach")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	log := filepath.Join(dir, "log")
+
+	// Item 1 fails at once; the execution for item 2 is killed and no
+	// further executions are started.
+	err = stream.Run(
+		stream.Numbers(1, 20),
+		stream.CommandEach("sh", "-c", "test {} != 1 || exit 1; sleep 1; echo {} >>"+log).Parallel(2),
 	)
+	var x *stream.ExitError
+	_, statErr := os.Stat(log)
+	fmt.Println(errors.As(err, &x), os.IsNotExist(statErr))
 	// Output:
-	// 1950 june
-	// 1970 feb
-	// 1970 march
-	// 1980 sep
+	// true true
 }
 
-func ExampleSorter_Num() {
+func ExampleShell() {
 	stream.Run(
-		stream.Items(
-			"a 100",
-			"b 20.3",
-			"c notanumber", // Will sort last since column 2 is not a number
-			"d",            // Will sort earliest since column 2 is missing
-		),
-		stream.Sort().Num(2),
+		stream.Items("foo 2", "bar", "foo 1", "foo 2"),
+		stream.Shell("grep foo | sort -u"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// d
-	// b 20.3
-	// a 100
-	// c notanumber
+	// foo 1
+	// foo 2
 }
 
-func ExampleSorter_NumDecreasing() {
+func ExampleShellWith() {
 	stream.Run(
-		stream.Items(
-			"a 100",
-			"b 20",
-			"c notanumber",
-			"d",
-		),
-		stream.Sort().NumDecreasing(2),
+		stream.ShellWith("bash", "echo ${BASH_VERSION:+bash}"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// c notanumber
-	// a 100
-	// b 20
-	// d
+	// bash
 }
 
-func ExampleSorter_Text() {
+func ExampleCoprocess() {
 	stream.Run(
-		stream.Items(
-			"10 bananas",
-			"20 apples",
-			"30", // Will sort first since column 2 is missing
-		),
-		stream.Sort().Text(2),
+		stream.Items("hello", "world"),
+		stream.Coprocess("sh", "-c", "while read x; do echo \"<$x>\"; done"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 30
-	// 20 apples
-	// 10 bananas
+	// <hello>
+	// <world>
 }
 
-func ExampleSorter_TextDecreasing() {
-	stream.Run(
-		stream.Items(
-			"10 bananas",
-			"20 apples",
-			"30", // Will sort first since column 2 is missing
-		),
-		stream.Sort().TextDecreasing(2),
+func ExampleCoprocessFilter_Restarts() {
+	// The helper exits after every response; each item after the
+	// first is handled by a restarted helper.
+	err := stream.Run(
+		stream.Items("a", "b", "c"),
+		stream.Coprocess("sh", "-c", "read x; echo $x$x").Restarts(1).Backoff(0),
 		stream.WriteLines(os.Stdout),
 	)
+	fmt.Println(err)
 	// Output:
-	// 10 bananas
-	// 20 apples
-	// 30
+	// aa
+	// bb
+	// cc
+	// <nil>
 }
 
-func ExampleSorter_By() {
-	stream.Run(
-		stream.Items("bananas", "apples", "pears"),
-		stream.Sort().By(func(a, b string) bool { return len(a) < len(b) }),
+func ExampleCoprocess_newline() {
+	err := stream.Run(
+		stream.Items("a", "b\nc"),
+		stream.Coprocess("sh", "-c", "while read x; do echo \"<$x>\"; done"),
 		stream.WriteLines(os.Stdout),
 	)
+	fmt.Println(err)
 	// Output:
-	// pears
-	// apples
-	// bananas
+	// <a>
+	// stage 2 (Coprocess): item "b\nc": stream.Coprocess: item contains a newline
 }
 
-func ExampleReverse() {
-	stream.Run(
-		stream.Items("a", "b"),
-		stream.Reverse(),
-		stream.WriteLines(os.Stdout),
+func ExampleCoprocess_canceled() {
+	// The helper never answers, so the filter waits until the
+	// pipeline is canceled, which kills the helper.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := stream.RunContext(ctx,
+		stream.Items("a"),
+		stream.Coprocess("sh", "-c", "sleep 1000"),
 	)
+	fmt.Println(errors.Is(err, context.DeadlineExceeded))
 	// Output:
-	// b
-	// a
+	// true
 }
 
-func ExampleSample() {
-	stream.Run(
-		stream.Numbers(100, 200),
-		stream.Sample(4),
-		stream.WriteLines(os.Stdout),
+func ExampleCoprocessFilter_Backoff() {
+	// The helper always dies, and the fake clock never advances, so
+	// the filter waits before restarting it until the pipeline is
+	// canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	clock := streamtest.NewClock(time.Now())
+	err := stream.NewRunner(stream.WithContext(ctx), stream.WithClock(clock)).Run(
+		stream.Items("a"),
+		stream.Coprocess("false").Backoff(time.Hour),
 	)
-	// Output not checked since it is non-deterministic.
+	fmt.Println(errors.Is(err, context.DeadlineExceeded))
+	// Output:
+	// true
 }
 
-func ExampleSampleWithSeed() {
+func ExampleShellQuote() {
 	stream.Run(
-		stream.Numbers(1, 100),
-		stream.SampleWithSeed(2, 100),
-		stream.Sort().Num(1),
+		stream.Items("a.txt", "it's here", "$(rm -rf /)", ""),
+		stream.ShellQuote(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 11
-	// 46
+	// a.txt
+	// 'it'\''s here'
+	// '$(rm -rf /)'
+	// ''
 }
 
-func ExampleFirst() {
+func ExampleCommandEachFilter_QuoteItems() {
 	stream.Run(
-		stream.Numbers(1, 10),
-		stream.First(3),
+		stream.Items("hello world", "$HOME; echo oops"),
+		stream.CommandEach("sh", "-c", "echo {}").QuoteItems(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 1
-	// 2
-	// 3
+	// hello world
+	// $HOME; echo oops
 }
 
-func ExampleLast() {
+func ExampleXargsFilter_QuoteItems() {
 	stream.Run(
-		stream.Numbers(1, 10),
-		stream.Last(2),
+		stream.Items("it's", "`date`"),
+		stream.Xargs("sh", "-c", "echo [{}]").Replace("{}").QuoteItems(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 9
-	// 10
+	// [it's]
+	// [`date`]
 }
 
-func ExampleDropFirst() {
+func ExampleXargs() {
 	stream.Run(
-		stream.Numbers(1, 10),
-		stream.DropFirst(8),
+		stream.Numbers(1, 5),
+		stream.Xargs("echo"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 9
-	// 10
+	// 1 2 3 4 5
 }
 
-func ExampleDropLast() {
+func ExampleXargsFilter_LimitArgs() {
 	stream.Run(
-		stream.Numbers(1, 10),
-		stream.DropLast(3),
+		stream.Numbers(1, 5),
+		stream.Xargs("echo").LimitArgs(2),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 1
-	// 2
-	// 3
-	// 4
+	// 1 2
+	// 3 4
 	// 5
-	// 6
-	// 7
 }
 
-func ExampleNumberLines() {
+func ExampleXargsFilter_Replace() {
 	stream.Run(
-		stream.Items("a", "b"),
-		stream.NumberLines(),
+		stream.Numbers(1, 3),
+		stream.Xargs("echo", "<", "{}", ">").Replace("{}"),
 		stream.WriteLines(os.Stdout),
 	)
-	// Output:
-	//     1 a
-	//     2 b
-}
-
-func ExampleColumns() {
 	stream.Run(
-		stream.Items("hello world"),
-		stream.Columns(2, 3, 1),
+		stream.Numbers(1, 3),
+		stream.Xargs("echo", "item-{}").Replace("{}"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// world hello
+	// < 1 2 3 >
+	// item-1
+	// item-2
+	// item-3
 }
 
-func ExampleFind() {
+func ExampleXargsFilter_Replace_limitArgs() {
 	stream.Run(
-		stream.Find(".").IfMode(os.FileMode.IsRegular),
-		stream.Grep("stream"),
+		stream.Items("a", "b", "c"),
+		stream.Xargs("echo", "x{}").Replace("{}").LimitArgs(10),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// stream.go
-	// stream_test.go
+	// xa
+	// xb
+	// xc
 }
 
-func ExampleFindFilter_SkipDirIf() {
+func ExampleXargsFilter_Parallel() {
 	stream.Run(
-		stream.Find(".").SkipDirIf(func(d string) bool { return d == ".git" }),
-		stream.Grep("x"),
+		stream.Numbers(1, 6),
+		stream.Xargs("sh", "-c", `echo "$@"; echo "$@"`, "sh").LimitArgs(2).Parallel(3),
+		stream.Sort(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// regexp.go
-	// xargs.go
-}
-
-func ExampleFind_error() {
-	err := stream.Run(stream.Find("/no_such_dir"))
-	if err == nil {
-		fmt.Println("stream.Find did not return expected error")
-	}
-	// Output:
+	// 1 2
+	// 1 2
+	// 3 4
+	// 3 4
+	// 5 6
+	// 5 6
 }
 
-func ExampleCat() {
+func ExampleXargsFilter_KeepOrder() {
 	stream.Run(
-		stream.Cat("stream_test.go"),
-		stream.Grep("^func ExampleCat"),
+		stream.Numbers(1, 6),
+		stream.Xargs("sh", "-c", `sleep 0.0$1; echo "$@"`, "sh").
+			LimitArgs(2).Parallel(3).KeepOrder(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// func ExampleCat() {
+	// 1 2
+	// 3 4
+	// 5 6
 }
 
-func ExampleWriteLines() {
-	stream.Run(
-		stream.Numbers(1, 3),
+func ExampleXargsFilter_KeepGoing() {
+	err := stream.Run(
+		stream.Numbers(1, 6),
+		stream.Xargs("sh", "-c", `echo "$@"; test $1 != 3`, "sh").LimitArgs(2).KeepGoing(),
 		stream.WriteLines(os.Stdout),
 	)
+	var e *stream.XargsError
+	if errors.As(err, &e) {
+		for _, f := range e.Failures {
+			fmt.Println("failed:", f.Index, f.Items, f.Code)
+		}
+	}
 	// Output:
-	// 1
-	// 2
-	// 3
+	// 1 2
+	// 3 4
+	// 5 6
+	// failed: 1 [3 4] 1
 }
 
-func ExampleReadLines() {
-	stream.Run(
-		stream.ReadLines(bytes.NewBufferString("the\nquick\nbrown\nfox\n")),
-		stream.Sort(),
+func ExampleXargsError() {
+	err := stream.Run(
+		stream.Numbers(1, 6),
+		stream.Xargs("sh", "-c", `echo "$@"; test $1 != 3`, "sh").LimitArgs(2),
 		stream.WriteLines(os.Stdout),
 	)
+	fmt.Println(err)
 	// Output:
-	// brown
-	// fox
-	// quick
-	// the
+	// 1 2
+	// 3 4
+	// stage 2 (Xargs): stream.Xargs: sh: execution 1 failed: exit status 1
 }
 
-func ExampleCommand() {
+func ExampleXargsFilter_WithIndex() {
 	stream.Run(
-		stream.Numbers(1, 100),
-		stream.Command("wc", "-l"),
+		stream.Numbers(1, 4),
+		stream.Xargs("echo").LimitArgs(2).WithIndex(),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 100
+	// 0:1 2
+	// 1:3 4
 }
 
-func ExampleCommand_outputOnly() {
+func ExampleXargsFilter_MergeStderr() {
 	stream.Run(
-		stream.Command("find", ".", "-type", "f", "-print"),
-		stream.Grep(`^\./stream.*\.go$`),
-		stream.Sort(),
+		stream.Numbers(1, 2),
+		stream.Xargs("sh", "-c", `echo "$@" >&2`, "sh").LimitArgs(1).MergeStderr(),
 		stream.WriteLines(os.Stdout),
 	)
-
 	// Output:
-	// ./stream.go
-	// ./stream_test.go
+	// stderr: 1
+	// stderr: 2
 }
 
-func ExampleCommand_withError() {
-	err := stream.Run(stream.Command("no_such_command"))
-	if err == nil {
-		fmt.Println("execution of missing command succeeded unexpectedly")
-	}
+func ExampleXargsFilter_Stderr() {
+	stream.Run(
+		stream.Numbers(1, 2),
+		stream.Xargs("sh", "-c", `echo "$@" >&2`, "sh").Stderr(os.Stdout),
+	)
 	// Output:
+	// 1 2
 }
 
-func ExampleXargs() {
+func ExampleXargs_nulTerminated() {
 	stream.Run(
-		stream.Numbers(1, 5),
-		stream.Xargs("echo"),
+		stream.Command("printf", `one file\000two\nlines\000`).SplitNul(),
+		stream.Xargs("sh", "-c", `for f; do echo "<$f>"; done`, "sh"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 1 2 3 4 5
+	// <one file>
+	// <two
+	// lines>
 }
 
-func ExampleXargsFilter_LimitArgs() {
+func ExampleXargs_splitArguments() {
+	// Xargs should split the long list of arguments into
+	// four executions to keep command length below 8192.
 	stream.Run(
-		stream.Numbers(1, 5),
-		stream.Xargs("echo").LimitArgs(2),
+		stream.Numbers(1, 2000),
+		stream.Xargs("echo").LimitBytes(8192),
+		stream.Command("wc", "-l"),
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 1 2
-	// 3 4
-	// 5
+	// 4
 }
 
-func ExampleXargs_splitArguments() {
-	// Xargs should split the long list of arguments into
-	// three executions to keep command length below 4096.
+func ExampleXargs_systemLimit() {
+	// By default, Xargs packs as many arguments into a command line as
+	// the operating system allows.
 	stream.Run(
 		stream.Numbers(1, 2000),
 		stream.Xargs("echo"),
@@ -524,5 +3123,5 @@ func ExampleXargs_splitArguments() {
 		stream.WriteLines(os.Stdout),
 	)
 	// Output:
-	// 3
+	// 1
 }
@@ -0,0 +1,171 @@
+package streamtest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghemawat/stream"
+)
+
+// CheckOption adjusts the properties verified by CheckFilter.
+type CheckOption func(*checkConfig)
+
+type checkConfig struct {
+	oneToOne bool
+	drains   bool
+	inputs   [][]string
+}
+
+// OneToOne makes CheckFilter verify that the filter emits exactly one
+// output item per input item.
+func OneToOne() CheckOption {
+	return func(c *checkConfig) { c.oneToOne = true }
+}
+
+// DrainsInput makes CheckFilter verify that the filter reads all of
+// its input before returning.
+func DrainsInput() CheckOption {
+	return func(c *checkConfig) { c.drains = true }
+}
+
+// Inputs adds inputs to those that CheckFilter feeds to the filter.
+func Inputs(inputs ...[]string) CheckOption {
+	return func(c *checkConfig) { c.inputs = append(c.inputs, inputs...) }
+}
+
+// CheckFilter runs filters created by newFilter against a variety of
+// generated inputs (empty input, empty items, long items, items with
+// unusual characters, and more items than fit in the channels between
+// stages) and reports a test failure if a filter breaks any of the
+// rules that all filters must follow:
+//
+//   - RunFilter must not panic.
+//   - RunFilter must not close Arg.Out.
+//   - RunFilter must not write to Arg.Out after it returns (e.g.,
+//     from a goroutine it did not wait for).
+//
+// Options can be supplied to check further properties.
+func CheckFilter(t testing.TB, newFilter func() stream.Filter, opts ...CheckOption) {
+	t.Helper()
+	var c checkConfig
+	for _, o := range opts {
+		o(&c)
+	}
+	for _, input := range append(generatedInputs(), c.inputs...) {
+		if err := checkOnce(newFilter(), input, &c); err != nil {
+			t.Errorf("%v (input: %s)", err, describeInput(input))
+		}
+	}
+}
+
+// generatedInputs returns the inputs used by CheckFilter.
+func generatedInputs() [][]string {
+	r := rand.New(rand.NewSource(1))
+	random := func(n, maxLen int) []string {
+		items := make([]string, n)
+		for i := range items {
+			b := make([]byte, r.Intn(maxLen+1))
+			const chars = " \t\n\x00aZ9-_/.\xff"
+			for j := range b {
+				b[j] = chars[r.Intn(len(chars))]
+			}
+			items[i] = string(b)
+		}
+		return items
+	}
+	many := make([]string, 5000)
+	for i := range many {
+		many[i] = fmt.Sprint(i)
+	}
+	return [][]string{
+		nil,
+		{""},
+		{"a"},
+		{"", "", ""},
+		{"hello world", "  leading and trailing  ", "tab\tseparated", "日本語"},
+		{strings.Repeat("x", 1<<20)},
+		random(20, 10),
+		random(200, 100),
+		many,
+	}
+}
+
+func describeInput(input []string) string {
+	if len(input) > 5 {
+		return fmt.Sprintf("%d items starting with %.40q", len(input), input[:5])
+	}
+	return fmt.Sprintf("%.80q", input)
+}
+
+// checkOnce runs f with input and returns an error describing the
+// first rule that f broke.
+func checkOnce(f stream.Filter, input []string, c *checkConfig) (err error) {
+	in := make(chan string)
+	fed := make(chan int)
+	go func() {
+		n := 0
+		for _, s := range input {
+			in <- s
+			n++
+		}
+		close(in)
+		fed <- n
+	}()
+	out := make(chan string)
+	returned := make(chan any, 1) // Receives the value passed to panic, if any
+	go func() {
+		defer func() { returned <- recover() }()
+		f.RunFilter(stream.Arg{In: in, Out: out})
+	}()
+
+	// Collect output until the filter returns, and then for a little
+	// longer to catch stray writes.
+	var panicked any
+	var outputs int
+	var late, closedByFilter bool
+	var timeout <-chan time.Time
+	for done := false; !done; {
+		select {
+		case _, ok := <-out:
+			switch {
+			case !ok:
+				closedByFilter = true
+				out = nil
+			case timeout != nil:
+				late = true
+			default:
+				outputs++
+			}
+		case panicked = <-returned:
+			timeout = time.After(50 * time.Millisecond)
+		case <-timeout:
+			done = true
+		}
+	}
+	drained := true
+	select {
+	case <-fed:
+	default:
+		drained = false
+		for range in {
+		}
+		<-fed
+	}
+
+	switch {
+	case panicked != nil:
+		return fmt.Errorf("RunFilter panicked: %v", panicked)
+	case closedByFilter:
+		return fmt.Errorf("RunFilter closed Arg.Out")
+	case late:
+		return fmt.Errorf("output written after RunFilter returned")
+	case c.drains && !drained:
+		return fmt.Errorf("RunFilter returned without reading all input")
+	case c.oneToOne && outputs != len(input):
+		return fmt.Errorf("RunFilter emitted %d items for %d inputs", outputs, len(input))
+	}
+	return nil
+}
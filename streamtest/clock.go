@@ -0,0 +1,77 @@
+package streamtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghemawat/stream"
+)
+
+// Clock is a fake stream.Clock whose time only changes when Advance
+// is called. Use it with stream.WithClock to test filters that depend
+// on the time.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+}
+
+// NewClock returns a Clock whose current time is now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of c.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker that ticks when c is advanced past each
+// multiple of d after the current time.
+func (c *Clock) NewTicker(d time.Duration) stream.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &ticker{c: c, ch: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the current time of c forward by d, delivering ticks
+// to tickers that become due. As with time.Ticker, ticks are dropped
+// if the receiver is not keeping up.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		for !t.next.After(c.now) {
+			select {
+			case t.ch <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+type ticker struct {
+	c      *Clock
+	ch     chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *ticker) C() <-chan time.Time { return t.ch }
+
+func (t *ticker) Stop() {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	for i, x := range t.c.tickers {
+		if x == t {
+			t.c.tickers = append(t.c.tickers[:i], t.c.tickers[i+1:]...)
+			break
+		}
+	}
+}
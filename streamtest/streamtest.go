@@ -0,0 +1,152 @@
+// Package streamtest provides helpers for testing filters written for
+// the github.com/ghemawat/stream package.
+package streamtest
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghemawat/stream"
+)
+
+// Run executes f with the supplied input items and returns its output
+// items and error.
+func Run(f stream.Filter, input ...string) ([]string, error) {
+	var out []string
+	err := stream.ForEach(stream.Sequence(stream.Items(input...), f), func(s string) {
+		out = append(out, s)
+	})
+	return out, err
+}
+
+// Check executes f with the supplied input items and reports a test
+// failure if f fails or its output differs from want.
+func Check(t testing.TB, f stream.Filter, input, want []string) {
+	t.Helper()
+	got, err := Run(f, input...)
+	if err != nil {
+		t.Errorf("filter failed: %v", err)
+		return
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("wrong output for input %q:\ngot:  %q\nwant: %q", input, got, want)
+	}
+}
+
+// CheckError executes f with the supplied input items and reports a
+// test failure unless f fails with an error whose text contains
+// substr.
+func CheckError(t testing.TB, f stream.Filter, input []string, substr string) {
+	t.Helper()
+	_, err := Run(f, input...)
+	switch {
+	case err == nil:
+		t.Errorf("filter succeeded for input %q; want error containing %q", input, substr)
+	case !strings.Contains(err.Error(), substr):
+		t.Errorf("filter failed with %q; want error containing %q", err, substr)
+	}
+}
+
+// UpdateEnv is the name of an environment variable that, if set to a
+// non-empty value, makes Golden rewrite golden files instead of
+// comparing against them.
+const UpdateEnv = "STREAMTEST_UPDATE"
+
+// Golden executes f with the supplied input items and compares its
+// output, one item per line, with the contents of the file named by
+// path. A test failure is reported if they differ. If the environment
+// variable named by UpdateEnv is set, the file is rewritten with the
+// output instead.
+func Golden(t testing.TB, f stream.Filter, input []string, path string) {
+	t.Helper()
+	got, err := Run(f, input...)
+	if err != nil {
+		t.Errorf("filter failed: %v", err)
+		return
+	}
+	text := strings.Join(got, "\n")
+	if len(got) > 0 {
+		text += "\n"
+	}
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.WriteFile(path, []byte(text), 0666); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%v (set %s=1 to create it)", err, UpdateEnv)
+		return
+	}
+	if string(want) != text {
+		t.Errorf("output differs from %s (set %s=1 to update it):\ngot:\n%swant:\n%s",
+			path, UpdateEnv, text, want)
+	}
+}
+
+// Arg is a fake stream.Arg for calling a filter's RunFilter method
+// directly.
+type Arg struct {
+	stream.Arg
+	done chan []string
+}
+
+// NewArg returns an Arg whose input channel yields input and is then
+// closed. Items written to its output channel are collected and
+// returned by Output.
+func NewArg(input ...string) *Arg {
+	in := make(chan string, len(input))
+	for _, s := range input {
+		in <- s
+	}
+	close(in)
+	out := make(chan string)
+	a := &Arg{Arg: stream.Arg{In: in, Out: out}, done: make(chan []string)}
+	go func() {
+		var items []string
+		for s := range out {
+			items = append(items, s)
+		}
+		a.done <- items
+	}()
+	return a
+}
+
+// Output closes the output channel of a and returns the items that
+// were written to it. It must be called once, after the filter has
+// returned.
+func (a *Arg) Output() []string {
+	close(a.Out)
+	return <-a.done
+}
+
+// CheckLeaks arranges for a test failure to be reported at the end of
+// the test if it leaves behind more goroutines than were running when
+// CheckLeaks was called. Goroutines are given a second to finish.
+// Tests that call CheckLeaks should not run in parallel with other
+// tests.
+func CheckLeaks(t testing.TB) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(time.Second)
+		for {
+			n := runtime.NumGoroutine()
+			if n <= before {
+				return
+			}
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				buf = buf[:runtime.Stack(buf, true)]
+				t.Errorf("%d goroutines leaked:\n%s", n-before, buf)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
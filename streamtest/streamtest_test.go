@@ -0,0 +1,190 @@
+package streamtest_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghemawat/stream"
+	"github.com/ghemawat/stream/streamtest"
+)
+
+func ExampleRun() {
+	out, err := streamtest.Run(stream.Map(strings.ToUpper), "a", "b")
+	fmt.Println(out, err)
+	// Output:
+	// [A B] <nil>
+}
+
+func ExampleNewArg() {
+	arg := streamtest.NewArg("1", "2", "3")
+	err := stream.Reverse().RunFilter(arg.Arg)
+	fmt.Println(arg.Output(), err)
+	// Output:
+	// [3 2 1] <nil>
+}
+
+func ExampleClock() {
+	clock := streamtest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	r := stream.NewRunner(stream.WithClock(clock))
+	r.Run(
+		stream.Items("a", "b"),
+		stream.Debug("item").To(os.Stdout).TimeFormat(time.Kitchen),
+	)
+	// Output:
+	// item #1 3:04AM a
+	// item #2 3:04AM b
+}
+
+func TestSampleWithRand(t *testing.T) {
+	run := func() []string {
+		r := stream.NewRunner(stream.WithRand(rand.NewSource(1)))
+		out, err := r.Contents(stream.Numbers(1, 100), stream.Sample(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	a, b := run(), run()
+	if !slices.Equal(a, b) {
+		t.Errorf("samples differ: %q vs %q", a, b)
+	}
+}
+
+func TestProgressInterval(t *testing.T) {
+	clock := streamtest.NewClock(time.Unix(0, 0))
+	reports := make(chan stream.ProgressStatus)
+	in := make(chan string)
+	go stream.NewRunner(stream.WithClock(clock)).Run(
+		stream.FilterFunc(func(arg stream.Arg) error {
+			for s := range in {
+				arg.Out <- s
+			}
+			return nil
+		}),
+		stream.ProgressFunc(func(p stream.ProgressStatus) { reports <- p }).Every(0).Interval(time.Second),
+	)
+	in <- "a"
+	in <- "b"
+	for done := false; !done; {
+		clock.Advance(time.Second) // The ticker may not exist yet
+		select {
+		case p := <-reports:
+			if p.Items == 2 {
+				if p.Rate <= 0 || p.Elapsed%time.Second != 0 {
+					t.Errorf("bad report %+v", p)
+				}
+				done = true
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(in)
+	if p := <-reports; !p.Done {
+		t.Errorf("final report %+v not done", p)
+	}
+}
+
+func TestWatchdogClock(t *testing.T) {
+	clock := streamtest.NewClock(time.Unix(0, 0))
+	stalls := make(chan *stream.Stall, 1)
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- stream.NewRunner(
+			stream.WithClock(clock),
+			stream.WithWatchdog(time.Minute, func(s *stream.Stall) { stalls <- s }),
+		).Run(
+			stream.Items("a"),
+			stream.FilterFunc(func(arg stream.Arg) error {
+				<-release // Never reads its input until released
+				for range arg.In {
+				}
+				return nil
+			}),
+		)
+	}()
+	// The watchdog only sees time pass when the fake clock advances.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case s := <-stalls:
+		t.Fatalf("stall reported before clock advanced: %v", s.Duration)
+	default:
+	}
+	var s *stream.Stall
+	for s == nil {
+		clock.Advance(time.Minute) // The ticker may not exist yet
+		select {
+		case s = <-stalls:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if s.Duration < time.Minute || s.Duration%time.Minute != 0 {
+		t.Errorf("stall duration %v is not a multiple of the clock steps", s.Duration)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	streamtest.CheckLeaks(t)
+	streamtest.Check(t, stream.Grep("a"), []string{"a", "b", "ca"}, []string{"a", "ca"})
+	streamtest.CheckError(t, stream.Grep("("), []string{"a"}, "missing closing )")
+}
+
+func TestGolden(t *testing.T) {
+	streamtest.Golden(t, stream.Reverse(), []string{"1", "2", "3"}, "testdata/reverse.golden")
+}
+
+func TestCheckFilter(t *testing.T) {
+	streamtest.CheckFilter(t, func() stream.Filter { return stream.Map(strings.ToUpper) },
+		streamtest.OneToOne(), streamtest.DrainsInput())
+	streamtest.CheckFilter(t, func() stream.Filter { return stream.Sort().Num(1) },
+		streamtest.OneToOne(), streamtest.DrainsInput())
+	streamtest.CheckFilter(t, func() stream.Filter { return stream.First(3) })
+	streamtest.CheckFilter(t, func() stream.Filter { return stream.Grep("a") },
+		streamtest.Inputs([]string{"a", "b", "ba"}))
+}
+
+func TestCheckFilterCatchesMistakes(t *testing.T) {
+	bad := map[string]stream.Filter{
+		"closes output": stream.FilterFunc(func(arg stream.Arg) error {
+			close(arg.Out)
+			return nil
+		}),
+		"panics": stream.FilterFunc(func(arg stream.Arg) error {
+			panic("oops")
+		}),
+		"drops items": stream.FilterFunc(func(arg stream.Arg) error {
+			for range arg.In {
+			}
+			return nil
+		}),
+	}
+	for name, f := range bad {
+		var errs []string
+		rec := recorder{errs: &errs}
+		streamtest.CheckFilter(rec, func() stream.Filter { return f }, streamtest.OneToOne())
+		if len(errs) == 0 {
+			t.Errorf("%s: no problems reported", name)
+		}
+	}
+}
+
+// recorder is a testing.TB that records errors instead of failing.
+type recorder struct {
+	testing.TB
+	errs *[]string
+}
+
+func (r recorder) Helper() {}
+
+func (r recorder) Errorf(format string, args ...any) {
+	*r.errs = append(*r.errs, fmt.Sprintf(format, args...))
+}
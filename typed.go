@@ -0,0 +1,85 @@
+package stream
+
+// ItemsOf emits items.
+func ItemsOf[T any](items ...T) FilterOf[T] {
+	return StageFunc[T, T](func(arg ArgOf[T, T]) error {
+		for _, x := range items {
+			if err := arg.Send(x); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MapOf calls fn(x) for every item x and yields the outputs of the fn
+// calls. Unlike Map, the output may have a different type than the
+// input.
+func MapOf[T, U any](fn func(T) U) StageOf[T, U] {
+	return StageFunc[T, U](func(arg ArgOf[T, U]) error {
+		for x := range arg.In {
+			arg.Out <- fn(x)
+		}
+		return nil
+	})
+}
+
+// IfOf emits every input x for which fn(x) is true.
+func IfOf[T any](fn func(T) bool) FilterOf[T] {
+	return StageFunc[T, T](func(arg ArgOf[T, T]) error {
+		for x := range arg.In {
+			if fn(x) {
+				arg.Out <- x
+			}
+		}
+		return nil
+	})
+}
+
+// Then returns a stage that feeds the output of first to second. Use
+// SequenceOf or Sequence instead to chain stages whose input and
+// output types are all the same.
+func Then[T, U, V any](first StageOf[T, U], second StageOf[U, V]) StageOf[T, V] {
+	return StageFunc[T, V](func(arg ArgOf[T, V]) error {
+		e := &filterErrors{}
+		mid := make(chan U, channelBuffer)
+		stop := newStopSignal()
+		go runFilter(first, ArgOf[T, U]{In: arg.In, Out: mid, env: arg.env, inStop: arg.inStop, outStop: stop}, e)
+		out := make(chan V, channelBuffer)
+		go runFilter(second, ArgOf[U, V]{In: mid, Out: out, env: arg.env, inStop: stop, outStop: arg.outStop}, e)
+		for x := range out {
+			arg.Out <- x
+		}
+		return e.getError()
+	})
+}
+
+// RunOf executes stage and discards all output. It returns either
+// nil, or an error if any filter reported an error. The input of
+// stage is empty.
+func RunOf[T, U any](stage StageOf[T, U]) error {
+	return forEachWhile(&defaultRunner.env, stage, func(U) bool { return true })
+}
+
+// ForEachOf calls fn(x) for every item x in the output of stage and
+// returns either nil, or any error reported by the execution of the
+// stage.
+func ForEachOf[T, U any](stage StageOf[T, U], fn func(x U)) error {
+	return forEachWhile(&defaultRunner.env, stage, func(x U) bool {
+		fn(x)
+		return true
+	})
+}
+
+// ContentsOf returns a slice that contains all items that are the
+// output of stage.
+func ContentsOf[T, U any](stage StageOf[T, U]) ([]U, error) {
+	var result []U
+	err := ForEachOf(stage, func(x U) {
+		result = append(result, x)
+	})
+	if err != nil {
+		result = nil // Discard results on error
+	}
+	return result, err
+}
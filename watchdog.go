@@ -0,0 +1,130 @@
+package stream
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Stall describes a pipeline that has stopped making progress. It is
+// passed to the function supplied to WithWatchdog.
+type Stall struct {
+	Duration time.Duration // How long the pipeline has been stalled
+	Stages   []StageStatus // Status of every stage, in pipeline order
+	Stacks   string        // Stack traces of all goroutines
+}
+
+// StageStatus describes the state of one stage of a stalled pipeline.
+type StageStatus struct {
+	Index int    // Position of the stage in the pipeline, starting at 0
+	Name  string // Name given to the stage by Named, if any
+	State string // E.g., "waiting for input", "not reading input", "finished"
+}
+
+// String returns a multi-line description of the stall, including
+// stack traces.
+func (s *Stall) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "stream: pipeline stalled for %v\n", s.Duration)
+	for _, st := range s.Stages {
+		if st.Name != "" {
+			fmt.Fprintf(&b, "  stage %d (%s): %s\n", st.Index, st.Name, st.State)
+		} else {
+			fmt.Fprintf(&b, "  stage %d: %s\n", st.Index, st.State)
+		}
+	}
+	b.WriteString(s.Stacks)
+	return b.String()
+}
+
+// WithWatchdog arranges for fn to be called if no items have moved
+// between the stages of a pipeline executed by the Runner for at
+// least threshold, even though some stages have not finished. This
+// typically indicates a filter that never reads its input, or one that
+// waits for something that will never happen. fn is called at most
+// once per stall. A stage that performs a long computation without
+// reading or writing items is also reported.
+//
+// Every stall is also logged at level Warn (see WithLogger); fn may
+// be nil if that is all that is needed. Time is measured with the clock
+// of the pipeline (see WithClock).
+//
+// The watchdog only observes the top-level filters passed to Run,
+// ForEach, or Contents; filters nested inside them (e.g., via
+// Sequence or Parallel) are observed as part of their enclosing
+// stage. Items are passed between stages via extra goroutines that
+// count them, so a watched pipeline runs somewhat slower.
+func WithWatchdog(threshold time.Duration, fn func(*Stall)) RunOption {
+	return func(r *Runner) {
+		r.watchdog = &watchdog{threshold: threshold, fn: fn}
+	}
+}
+
+type watchdog struct {
+	threshold time.Duration
+	fn        func(*Stall)
+}
+
+// stallDetector applies a watchdog to one execution of a pipeline.
+type stallDetector struct {
+	w        *watchdog
+	logger   *slog.Logger
+	stages   []*observedStage
+	last     int64     // Progress at last check
+	since    time.Time // Time of last observed progress
+	reported bool      // Current stall has been reported
+}
+
+func newStallDetector(w *watchdog, logger *slog.Logger, stages []*observedStage, now time.Time) *stallDetector {
+	d := &stallDetector{w: w, logger: logger, stages: stages, since: now}
+	d.last = d.progress()
+	return d
+}
+
+// progress returns a number that changes whenever the pipeline makes
+// progress.
+func (d *stallDetector) progress() int64 {
+	var n int64
+	for _, st := range d.stages {
+		n += st.items.Load()
+		if st.done.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// check reports a stall if there has been no progress for too long.
+func (d *stallDetector) check(now time.Time) {
+	if p := d.progress(); p != d.last {
+		d.last = p
+		d.since = now
+		d.reported = false
+		return
+	}
+	if stalled := now.Sub(d.since); stalled >= d.w.threshold && !d.reported {
+		d.reported = true
+		s := d.stall(stalled)
+		var attrs []any
+		for _, st := range s.Stages {
+			attrs = append(attrs, fmt.Sprintf("stage%d", st.Index), st.State)
+		}
+		d.logger.Warn("stream: pipeline stalled", append([]any{"duration", stalled}, attrs...)...)
+		if d.w.fn != nil {
+			d.w.fn(s)
+		}
+	}
+}
+
+func (d *stallDetector) stall(stalled time.Duration) *Stall {
+	s := &Stall{Duration: stalled}
+	for i := range d.stages {
+		state, _ := stageState(d.stages, i)
+		s.Stages = append(s.Stages, StageStatus{Index: i, Name: d.stages[i].name, State: state})
+	}
+	buf := make([]byte, 1<<20)
+	s.Stacks = string(buf[:runtime.Stack(buf, true)])
+	return s
+}
@@ -0,0 +1,58 @@
+package stream
+
+// Wrap returns a filter that calls before(arg), then runs f, and then
+// calls after(arg, err) with the error returned by f. Either function
+// may be nil. The error returned by f is also returned by the wrapped
+// filter. E.g., the following logs how long a stage takes:
+//
+//	var start time.Time
+//	stream.Wrap(f,
+//		func(stream.Arg) { start = time.Now() },
+//		func(arg stream.Arg, err error) {
+//			arg.Logger().Info("done", "elapsed", time.Since(start), "err", err)
+//		})
+func Wrap(f Filter, before func(Arg), after func(Arg, error)) Filter {
+	return FilterFunc(func(arg Arg) error {
+		if before != nil {
+			before(arg)
+		}
+		err := f.RunFilter(arg)
+		if after != nil {
+			after(arg, err)
+		}
+		return err
+	})
+}
+
+// Middleware transforms a filter, typically by wrapping it in another
+// filter that adds behavior (see Wrap).
+type Middleware func(Filter) Filter
+
+// WithMiddleware arranges for every top-level filter of a pipeline
+// executed by the Runner to be transformed by the supplied
+// middleware. The first middleware is the outermost. Every filter
+// keeps its name (see Named) in diagnostics such as StageError; for a
+// filter created by Named, the middleware is applied to the filter it
+// names.
+func WithMiddleware(m ...Middleware) RunOption {
+	return func(r *Runner) { r.middleware = append(r.middleware, m...) }
+}
+
+// applyMiddleware returns filters transformed by the middleware of r.
+func (r *Runner) applyMiddleware(filters []Filter) []Filter {
+	if len(r.middleware) == 0 {
+		return filters
+	}
+	result := make([]Filter, len(filters))
+	for i, f := range filters {
+		name := stageName(f)
+		if n, ok := f.(*namedFilter); ok {
+			f = n.f
+		}
+		for j := len(r.middleware) - 1; j >= 0; j-- {
+			f = r.middleware[j](f)
+		}
+		result[i] = &namedFilter{name: name, f: f}
+	}
+	return result
+}
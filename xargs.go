@@ -1,13 +1,33 @@
 package stream
 
-import "os/exec"
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
 // XargsFilter is a Filter that applies a command to every input item.
 type XargsFilter struct {
-	command    string
-	args       []string
-	limitArgs  int
-	limitBytes int
+	command     string
+	args        []string
+	limitArgs   int
+	limitBytes  int
+	placeholder string
+	parallel    int
+	keepOrder   bool
+	keepGoing   bool
+	stderr      io.Writer
+	mergeStderr bool
+	withIndex   bool
+	quote       bool
 }
 
 // Xargs returns a filter that executes "command args... items..."
@@ -16,18 +36,25 @@ type XargsFilter struct {
 // command line length restrictions).  The standard output of the
 // execution(s) is split into lines and the lines form the output of
 // the filter (with trailing newlines removed).
+//
+// Items are passed to the command verbatim, without any quoting or
+// splitting by a shell, so items that contain spaces, quotes, or
+// newlines are handled correctly. When reading items produced by
+// another program, use a NUL-terminated format to preserve such
+// items. E.g.,
+//
+//	stream.Run(
+//		stream.Command("find", ".", "-name", "*.txt", "-print0").SplitNul(),
+//		stream.Xargs("wc", "-l"),
+//		stream.WriteLines(os.Stdout),
+//	)
 func Xargs(command string, args ...string) *XargsFilter {
-	// Compute length of command+args
-	base := len(command)
-	for _, a := range args {
-		base += 1 + len(a)
-	}
-	return &XargsFilter{
-		command:    command,
-		args:       args,
-		limitArgs:  4096,
-		limitBytes: 4096 - 100 - base, // Posix limit with slop
+	x := &XargsFilter{
+		command:   command,
+		args:      args,
+		limitArgs: 4096,
 	}
+	return x.LimitBytes(systemLimitBytes())
 }
 
 // LimitArgs adjusts x so that no more than n input items are passed to
@@ -38,45 +65,419 @@ func (x *XargsFilter) LimitArgs(n int) *XargsFilter {
 	return x
 }
 
+// LimitBytes adjusts x so that the command line of a single command
+// execution (the command, its arguments, and the input items passed to
+// it) does not exceed n bytes. n is reduced if necessary to respect
+// the limit imposed by the operating system (ARG_MAX), which is also
+// the default limit.
+func (x *XargsFilter) LimitBytes(n int) *XargsFilter {
+	if max := systemLimitBytes(); n > max {
+		n = max
+	}
+	// Subtract length of command+args
+	n -= len(x.command)
+	for _, a := range x.args {
+		n -= 1 + len(a)
+	}
+	x.limitBytes = n
+	return x
+}
+
+// systemLimitBytes returns the maximum length of a command line,
+// taking into account the space used by the environment.
+func systemLimitBytes() int {
+	n := argMax() - 2048 // Slop, as recommended by POSIX
+	for _, e := range os.Environ() {
+		n -= len(e) + 1 + ptrSize
+	}
+	return n
+}
+
+// ptrSize is the size of the pointer that refers to each argument.
+const ptrSize = strconv.IntSize / 8
+
+// Replace adjusts x so that the input items are substituted for
+// placeholder instead of being appended after args. Every argument
+// equal to placeholder is replaced by the items handled by an
+// execution. If placeholder occurs within a longer argument, every
+// occurrence is replaced by the item and each execution handles a
+// single item (like "xargs -I"), whatever LimitArgs says. E.g.,
+//
+//	stream.Xargs("cp", "{}", "/backup/").Replace("{}")
+//	stream.Xargs("mv", "{}", "{}.old").Replace("{}")
+func (x *XargsFilter) Replace(placeholder string) *XargsFilter {
+	x.placeholder = placeholder
+	return x
+}
+
+// maxArgs returns the maximum number of items handled by an
+// execution.
+func (x *XargsFilter) maxArgs() int {
+	if x.placeholder != "" {
+		for _, a := range x.args {
+			if a != x.placeholder && strings.Contains(a, x.placeholder) {
+				return 1
+			}
+		}
+	}
+	return x.limitArgs
+}
+
+// QuoteItems adjusts x so that when an item is substituted into an
+// argument that contains more than just the Replace placeholder, the
+// item is quoted for a POSIX shell (see ShellQuote). E.g.,
+//
+//	stream.Xargs("sh", "-c", "cat {} | wc -l").Replace("{}").QuoteItems()
+func (x *XargsFilter) QuoteItems() *XargsFilter {
+	x.quote = true
+	return x
+}
+
+// Parallel adjusts x so that up to n executions of the command run
+// concurrently. The output of each execution is kept together, but
+// the outputs of different executions are merged in an unspecified
+// order unless KeepOrder is also called.
+func (x *XargsFilter) Parallel(n int) *XargsFilter {
+	x.parallel = n
+	return x
+}
+
+// KeepOrder adjusts x so that the outputs of parallel executions are
+// emitted in the order in which the executions were started.
+func (x *XargsFilter) KeepOrder() *XargsFilter {
+	x.keepOrder = true
+	return x
+}
+
+// Stderr adjusts x so that the standard error of every execution of
+// the command is written to w. By default, the standard error of the
+// command is discarded.
+func (x *XargsFilter) Stderr(w io.Writer) *XargsFilter {
+	x.stderr, x.mergeStderr = &lockedWriter{w: w}, false
+	return x
+}
+
+// MergeStderr adjusts x so that the standard error of every execution
+// of the command is split into lines that are emitted along with the
+// lines from its standard output. Each such line is prefixed by
+// "stderr: ".
+func (x *XargsFilter) MergeStderr() *XargsFilter {
+	x.stderr, x.mergeStderr = nil, true
+	return x
+}
+
+// WithIndex adjusts x so that every output line is prefixed by the
+// index of the execution that produced it followed by a colon.
+// Executions are numbered from 0 in the order they were started.
+func (x *XargsFilter) WithIndex() *XargsFilter {
+	x.withIndex = true
+	return x
+}
+
+// KeepGoing adjusts x so that a failed execution of the command does
+// not stop the filter: the remaining input items are still handled.
+// By default, no further executions are started after a failure.
+// Either way, the error returned by the filter is an *XargsError
+// that describes every failed execution.
+func (x *XargsFilter) KeepGoing() *XargsFilter {
+	x.keepGoing = true
+	return x
+}
+
 // RunFilter implements the Filter interface: it reads a sequence of items
 // from arg.In and passes them as arguments to "command args...".
 func (x *XargsFilter) RunFilter(arg Arg) error {
-	items := append([]string(nil), x.args...)
-	added := 0 // Bytes added to items since last execution.
+	f := &xargsFailures{command: x.command, keepGoing: x.keepGoing}
+	run := func(index int, batch []string) {
+		f.record(index, batch, x.execute(arg, index, batch, func(s string) {
+			arg.Out <- s
+		}))
+	}
+	var p *xargsPool
+	if x.parallel > 1 {
+		p = newXargsPool(x, arg, f)
+		run = p.submit
+	}
+	index := 0 // Index of next execution
+	limitArgs := x.maxArgs()
+	var batch []string
+	added := 0 // Bytes added to batch since last execution.
 	for s := range arg.In {
-		if len(items) > len(x.args) {
+		if len(batch) > 0 {
 			// See if we have hit a byte or arg limit.
-			if len(items)-len(x.args) >= x.limitArgs ||
-				added+1+len(s) >= x.limitBytes {
-				err := runCommand(arg, x.command, items...)
-				if err != nil {
-					return err
+			if len(batch) >= limitArgs ||
+				added+1+len(s)+ptrSize >= x.limitBytes {
+				if f.stopped() || arg.Context().Err() != nil {
+					break
 				}
-				items = items[0:len(x.args)]
+				run(index, batch)
+				index++
+				batch = nil
 				added = 0
 			}
 		}
-		items = append(items, s)
-		added += 1 + len(s)
+		batch = append(batch, s)
+		added += 1 + len(s) + ptrSize
 	}
-	if len(items) > len(x.args) {
-		return runCommand(arg, x.command, items...)
+	if len(batch) > 0 && !f.stopped() && arg.Context().Err() == nil {
+		run(index, batch)
 	}
-	return nil
+	if p != nil {
+		p.wait()
+	}
+	if err := f.err(); err != nil {
+		return err
+	}
+	return arg.Context().Err()
+}
+
+// XargsError is the error returned by an Xargs filter when one or
+// more executions of the command fail.
+type XargsError struct {
+	Command  string
+	Failures []XargsFailure // In order of execution
+}
+
+// XargsFailure describes a failed execution of an Xargs command.
+type XargsFailure struct {
+	Index int      // Executions are numbered from 0 in the order they were started
+	Items []string // Input items handled by the execution
+	Code  int      // Exit status, or -1 if the command did not exit normally
+	Err   error
 }
 
-func runCommand(arg Arg, command string, args ...string) error {
-	cmd := exec.Command(command, args...)
-	output, err := cmd.StdoutPipe()
+func (e *XargsError) Error() string {
+	if len(e.Failures) == 1 {
+		f := e.Failures[0]
+		return fmt.Sprintf("stream.Xargs: %s: execution %d failed: %v",
+			e.Command, f.Index, f.Err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "stream.Xargs: %s: %d executions failed:", e.Command, len(e.Failures))
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, " %d (%v)", f.Index, f.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the individual failed executions.
+func (e *XargsError) Unwrap() []error {
+	var result []error
+	for _, f := range e.Failures {
+		result = append(result, f.Err)
+	}
+	return result
+}
+
+// xargsFailures collects the failed executions of an XargsFilter.
+type xargsFailures struct {
+	command   string
+	keepGoing bool
+	mu        sync.Mutex
+	failures  []XargsFailure
+}
+
+func (f *xargsFailures) record(index int, batch []string, err error) {
+	if err == nil {
+		return
+	}
+	code := -1
+	var x *exec.ExitError
+	if errors.As(err, &x) {
+		code = x.ExitCode()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, XargsFailure{index, batch, code, err})
+}
+
+// stopped returns true if no further executions should be started.
+func (f *xargsFailures) stopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.keepGoing && len(f.failures) > 0
+}
+
+func (f *xargsFailures) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.failures) == 0 {
+		return nil
+	}
+	sort.Slice(f.failures, func(i, j int) bool {
+		return f.failures[i].Index < f.failures[j].Index
+	})
+	return &XargsError{f.command, f.failures}
+}
+
+// xargsPool runs executions of an XargsFilter concurrently.
+type xargsPool struct {
+	x     *XargsFilter
+	arg   Arg
+	f     *xargsFailures
+	mu    sync.Mutex // Serializes output when order is not preserved
+	wg    sync.WaitGroup
+	jobs  chan *xargsJob
+	order chan *xargsJob // Jobs in start order, if order is preserved
+	done  chan struct{}  // Closed when all ordered output is emitted
+}
+
+type xargsJob struct {
+	index  int
+	batch  []string
+	output []string
+	err    error
+	done   chan struct{} // Closed when output and err are filled in
+}
+
+func newXargsPool(x *XargsFilter, arg Arg, f *xargsFailures) *xargsPool {
+	p := &xargsPool{x: x, arg: arg, f: f, jobs: make(chan *xargsJob)}
+	p.wg.Add(x.parallel)
+	for i := 0; i < x.parallel; i++ {
+		go p.worker()
+	}
+	if x.keepOrder {
+		p.order = make(chan *xargsJob, x.parallel)
+		p.done = make(chan struct{})
+		go p.emitInOrder()
+	}
+	return p
+}
+
+// submit arranges for the command to be executed for batch.
+func (p *xargsPool) submit(index int, batch []string) {
+	j := &xargsJob{index: index, batch: batch, done: make(chan struct{})}
+	if p.order != nil {
+		p.order <- j
+	}
+	p.jobs <- j
+}
+
+// wait waits for all executions to finish.
+func (p *xargsPool) wait() {
+	close(p.jobs)
+	p.wg.Wait()
+	if p.order != nil {
+		close(p.order)
+		<-p.done
+	}
+}
+
+func (p *xargsPool) worker() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		j.err = p.x.execute(p.arg, j.index, j.batch, func(s string) {
+			j.output = append(j.output, s)
+		})
+		close(j.done)
+		if p.order == nil {
+			p.mu.Lock()
+			p.emit(j)
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *xargsPool) emitInOrder() {
+	for j := range p.order {
+		<-j.done
+		p.emit(j)
+	}
+	close(p.done)
+}
+
+func (p *xargsPool) emit(j *xargsJob) {
+	for _, s := range j.output {
+		p.arg.Out <- s
+	}
+	p.f.record(j.index, j.batch, j.err)
+}
+
+// argv returns the arguments for an execution that handles batch.
+func (x *XargsFilter) argv(batch []string) []string {
+	if x.placeholder == "" {
+		return append(append([]string(nil), x.args...), batch...)
+	}
+	var result []string
+	for _, a := range x.args {
+		switch {
+		case a == x.placeholder:
+			result = append(result, batch...)
+		case strings.Contains(a, x.placeholder) && x.quote:
+			result = append(result, strings.ReplaceAll(a, x.placeholder, shellQuote(batch[0])))
+		case strings.Contains(a, x.placeholder):
+			result = append(result, strings.ReplaceAll(a, x.placeholder, batch[0]))
+		default:
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// execute runs the command for the execution numbered index, which
+// handles the items in batch. It calls emit for every line of output.
+func (x *XargsFilter) execute(arg Arg, index int, batch []string, emit func(string)) error {
+	cmd := exec.CommandContext(arg.Context(), x.command, x.argv(batch)...)
+	prefix := ""
+	if x.withIndex {
+		prefix = strconv.Itoa(index) + ":"
+	}
+	var mu sync.Mutex // Serializes emit calls for stdout and stderr
+	output := func(rd io.Reader, tag string) error {
+		scanner := bufio.NewScanner(rd)
+		for scanner.Scan() {
+			mu.Lock()
+			emit(prefix + tag + scanner.Text())
+			mu.Unlock()
+		}
+		return scanner.Err()
+	}
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
+	var stderr io.Reader
+	if x.mergeStderr {
+		if stderr, err = cmd.StderrPipe(); err != nil {
+			return err
+		}
+	} else if x.stderr != nil {
+		cmd.Stderr = x.stderr
+	}
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		return err
 	}
-	if err := splitIntoLines(output, arg); err != nil {
-		cmd.Wait()
+	var wg sync.WaitGroup
+	var serr error // Records error reading stderr
+	if stderr != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serr = output(stderr, "stderr: ")
+		}()
+	}
+	oerr := output(stdout, "")
+	wg.Wait()
+	err = cmd.Wait()
+	logExit(arg, cmd, start, err)
+	if err != nil {
 		return err
 	}
-	return cmd.Wait()
+	if oerr != nil {
+		return oerr
+	}
+	return serr
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
 }